@@ -9,17 +9,43 @@ import (
 )
 
 type Board struct {
-	Pixels []uint8 // each element will have 2 pixles (4 bits each)
-	Width  uint16
-	Height uint16
+	Pixels       []uint8 // packed with BitsPerPixel bits per pixel, high bits first
+	Width        uint16
+	Height       uint16
+	BitsPerPixel uint8
+	Version      uint64 // sequence number of the last write included in Pixels
 }
 
+// boards served before the bits per pixel were part of the metadata
+const DEFAULT_BITS_PER_PIXEL = 4
+
 func Panicln(err error) {
 	if err != nil {
 		panic(err.Error())
 	}
 }
 
+// UnpackPixels returns the color index of every pixel of the board, one byte per pixel, with the
+// same bit layout as redis BITFIELD u<BitsPerPixel>
+func UnpackPixels(board Board) []uint8 {
+	bits := int(board.BitsPerPixel)
+	if bits == 0 {
+		bits = DEFAULT_BITS_PER_PIXEL
+	}
+
+	pixels := make([]uint8, int(board.Width)*int(board.Height))
+	for i := range pixels {
+		for bit := i * bits; bit < (i+1)*bits; bit++ {
+			pixels[i] <<= 1
+			if bit/8 < len(board.Pixels) {
+				pixels[i] |= (board.Pixels[bit/8] >> (7 - bit%8)) & 1
+			}
+		}
+	}
+
+	return pixels
+}
+
 func FetchBoard(_ js.Value, args []js.Value) interface{} {
 	go func() {
 		if len(args) != 2 {
@@ -41,9 +67,14 @@ func FetchBoard(_ js.Value, args []js.Value) interface{} {
 		err = json.Unmarshal(data, &board)
 		Panicln(err)
 
-		fmt.Println("Last Pixel Color: ", board.Pixels[len(board.Pixels)-1])
+		pixels := UnpackPixels(board)
+		fmt.Println("Last Pixel Color: ", pixels[len(pixels)-1])
+
+		// copied into a byte array, a string would mangle indices above 127
+		array := js.Global().Get("Uint8Array").New(len(pixels))
+		js.CopyBytesToJS(array, pixels)
 
-		callback.Invoke(string(board.Pixels), js.Null())
+		callback.Invoke(array, js.Null(), float64(board.Version), float64(board.Width), float64(board.Height))
 	}()
 	return js.Null()
 }
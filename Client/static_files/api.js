@@ -2,10 +2,26 @@ const SOCKET_ENDPOINT = "a3-te-loadb-1o7xofs5mgr87-1713514427.us-east-1.elb.amaz
 const ENDPOINT = "d238qs7496gem2.cloudfront.net"
 const PROXY = "localhost:8000"
 const USE_PROXY = false
+// set when the client is served by the go server running in standalone mode
+const USE_STANDALONE = false
+const SOCKET_RECONNECT_DELAY = 1000
+// localStorage key of the session token from /api/auth
+const TOKEN_KEY = 'token'
 /**
  * @type {WebSocket}
  */
 var socket
+/**
+ * sequence number of the latest board update received on the socket
+ */
+var lastSeq = 0
+// must match BOARD_CHUNK_SIZE in Server/chunks.go
+const CHUNK_SIZE = 50
+/**
+ * chunks the socket is subscribed to, as "cx,cy" keys
+ * @type {Set<string>}
+ */
+var subscribedChunks = new Set()
 var GoCtx
 
 /**
@@ -14,6 +30,7 @@ var GoCtx
  * @callback BoardFetchFinishCallback
  * @param {string} pixels
  * @param {error} err
+ * @param {number} version sequence number of the last write included in pixels
  */
 
 /**
@@ -42,65 +59,155 @@ function HandleMessage(ev) {
 }
 
 function GetEndpoint() {
+    if (USE_STANDALONE)
+        return `${window.location.protocol}//${window.location.host}`
+
     if (USE_PROXY)
         return `http://${PROXY}/http://${ENDPOINT}`
     
     return `http://${ENDPOINT}`
 }
 
+function GetSocketEndpoint() {
+    if (USE_STANDALONE)
+        return `ws://${window.location.host}/ws`
+
+    return `ws://${SOCKET_ENDPOINT}/ws`
+}
+
+/**
+ * @param {string} operation "login" or "register"
+ * @param {string} user
+ * @param {string} password
+ * @returns {Promise<Response>}
+ */
+function PostCredentials(operation, user, password) {
+    return fetch(`${GetEndpoint()}/api/auth/${operation}`, {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json"
+        },
+        body: JSON.stringify({
+            "User": user,
+            "Password": password
+        })
+    })
+}
+
+/**
+ * Logs in, registering the user first if the name is not taken yet, and keeps the session token
+ * @param {string} user
+ * @param {string} password
+ * @returns {Promise<boolean>} whether the user is logged in
+ */
+async function API_Authenticate(user, password) {
+    let res = await PostCredentials("login", user, password)
+    if (res.status == 401)
+        res = await PostCredentials("register", user, password)
+
+    if (res.status != 200) {
+        console.error("[API]: /api/auth failed due to", res)
+        return false
+    }
+
+    const session = await res.json()
+    localStorage.setItem(TOKEN_KEY, session.token)
+    localStorage.setItem(USERNAME_KEY, session.user)
+    return true
+}
+
+function API_IsAuthenticated() {
+    return localStorage.getItem(TOKEN_KEY) != null
+}
+
+/**
+ * @returns {Object} headers authenticating a request as the logged in user
+ */
+function GetAuthHeaders() {
+    return {
+        "Content-Type": "application/json",
+        "Authorization": `Bearer ${localStorage.getItem(TOKEN_KEY)}`
+    }
+}
+
+/**
+ * The session expired or was never valid, log in again on the next load
+ * @param {Response} res
+ */
+function CheckSession(res) {
+    if (res.status != 401)
+        return
+
+    localStorage.removeItem(TOKEN_KEY)
+    alert("Your session expired, reload the page to log in again.")
+}
+
 /**
  * 
  * @param {number} x x coordinate of pixel from top left
  * @param {number} y y coordinate of pixel from top left
- * @param {string} user username of user writing
  * @param {number} color a valid color number from color map
  */
-async function API_WritePixel(x, y, color, user) {
+async function API_WritePixel(x, y, color) {
     console.log({
         "X": x,
         "Y": y,
-        "Col": parseInt(color),
-        "User": user
+        "Col": parseInt(color)
     })
-    const waitTime = await API_GetUser(user)
-    if (waitTime > 0) {
-        alert(`You still have to wait ${waitTime} seconds before putting another tile.`)
+    const status = await API_GetUser()
+    if (status && !status.canPlace) {
+        alert(`You still have to wait ${status.secondsRemaining} seconds before putting another tile.`)
         return
     }
 
-    const finalURL = USE_PROXY ? `http://${PROXY}/http://${ENDPOINT}/api/writepixel` : `http://${ENDPOINT}/api/writepixel`
+    const finalURL = `${GetEndpoint()}/api/writepixel`
 
     const res = await fetch(finalURL, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json"
-        },
+        headers: GetAuthHeaders(),
         body: JSON.stringify({
             "X": x,
             "Y": y,
-            "Col": parseInt(color),
-            "User": user
+            "Col": parseInt(color)
         })
     })
+    CheckSession(res)
     if (res.status != 200) {
         console.error("[API]: /api/writepixel failed due to", res)
     }
 }
 
-async function API_GetUser(user){
+/**
+ * @returns {Promise<{canPlace: boolean, secondsRemaining: number, nextPlacementAt: string, serverTime: string}>}
+ * when the user can place its next pixel by the server clock, null if it could not be fetched
+ */
+async function API_GetUser(){
 
-    const finalURL = USE_PROXY ? `http://${PROXY}/http://${ENDPOINT}/api/getuser` : `http://${ENDPOINT}/api/getuser`
+    const finalURL = `${GetEndpoint()}/api/getuser`
 
-    const waitTime = await fetch(finalURL, {
+    const res = await fetch(finalURL, {
         method: "POST",
-        headers: {
-            "Content-Type": "application/json"
-        },
-        body: JSON.stringify({
-            "User": user
-        })
-    }).then((response) => {return response.json()})
-    return waitTime
+        headers: GetAuthHeaders(),
+        body: JSON.stringify({})
+    })
+    CheckSession(res)
+    if (res.status != 200)
+        return null
+
+    return await res.json()
+}
+
+/**
+ * @returns {Promise<Array<{name: string, hex: string}>>} the colors pixels can be painted with, ordered by color index
+ */
+async function API_GetPalette() {
+    const res = await fetch(`${GetEndpoint()}/api/palette`)
+    if (res.status != 200) {
+        console.error("[API]: /api/palette failed due to", res)
+        return []
+    }
+
+    return await res.json()
 }
 /**
  * @param {PixelUpdateCallback} onupdate This callback is called when the socket server pushes an update for a single pixel
@@ -112,9 +219,89 @@ async function InitAPIConnection(onupdate) {
     const wasmCtx = await WebAssembly.instantiateStreaming(fetch("main.wasm"), go.importObject)
     GoCtx = go.run(wasmCtx.instance);
 
-    socket = new WebSocket(`ws://${SOCKET_ENDPOINT}/ws`)
+    ConnectSocket(onupdate)
+}
+
+/**
+ * Updates up to version are part of a board snapshot we hold, a reconnect only needs what came after it
+ * @param {number} version
+ */
+function API_SetResumePoint(version) {
+    if (version > lastSeq)
+        lastSeq = version
+}
+
+/**
+ * @param {PixelUpdateCallback} onupdate
+ */
+function ConnectSocket(onupdate) {
+    // resume from the last update we saw so the server replays what we missed while disconnected
+    const params = new URLSearchParams()
+    if (lastSeq > 0)
+        params.set("since", lastSeq)
+
+    // browsers can't set headers on websocket requests
+    const token = localStorage.getItem(TOKEN_KEY)
+    if (token)
+        params.set("token", token)
+
+    let endpoint = GetSocketEndpoint()
+    if (params.toString())
+        endpoint += `?${params}`
+
+    socket = new WebSocket(endpoint)
+    let pingInterval = null
     socket.onopen = function () {
-        setInterval(() => this.send("ping"), 2000)
+        pingInterval = setInterval(() => this.send("ping"), 2000)
+        SendChunkRequest("subscribe", [...subscribedChunks])
     }
-    socket.onmessage = onupdate
-}
\ No newline at end of file
+    socket.onmessage = function (ev) {
+        const update = JSON.parse(ev.data)
+        if (update.type === "resync")
+            lastSeq = 0
+        else if (update.seq > lastSeq)
+            lastSeq = update.seq
+
+        onupdate(ev)
+    }
+    socket.onclose = function () {
+        clearInterval(pingInterval)
+        setTimeout(() => ConnectSocket(onupdate), SOCKET_RECONNECT_DELAY)
+    }
+}
+/**
+ * @param {string} type "subscribe" or "unsubscribe"
+ * @param {Array<string>} chunks "cx,cy" keys
+ */
+function SendChunkRequest(type, chunks) {
+    if (chunks.length == 0 || !socket || socket.readyState !== WebSocket.OPEN)
+        return
+
+    socket.send(JSON.stringify({
+        "type": type,
+        "chunks": chunks.map((key) => key.split(",").map(Number))
+    }))
+}
+
+/**
+ * Only receive updates for the chunks covering a rectangle of the board
+ * @param {number} x
+ * @param {number} y
+ * @param {number} width
+ * @param {number} height
+ */
+function API_SubscribeToRegion(x, y, width, height) {
+    const wanted = new Set()
+    for (let cy = Math.floor(y / CHUNK_SIZE); cy <= Math.floor((y + height - 1) / CHUNK_SIZE); cy++) {
+        for (let cx = Math.floor(x / CHUNK_SIZE); cx <= Math.floor((x + width - 1) / CHUNK_SIZE); cx++) {
+            wanted.add(`${cx},${cy}`)
+        }
+    }
+
+    const added = [...wanted].filter((key) => !subscribedChunks.has(key))
+    const removed = [...subscribedChunks].filter((key) => !wanted.has(key))
+    subscribedChunks = wanted
+
+    SendChunkRequest("unsubscribe", removed)
+    SendChunkRequest("subscribe", added)
+}
@@ -1,270 +1,409 @@
-const USERNAME_KEY = 'username'
-/**
- * @type {Board}
- */
-var board
-
-/**
- * @type {Renderer}
- */
-var renderer
-
-/**
- * @param {Object} stats 
- */
-function LogStats(stats) {
-	// console.clear()
-	for (const key in stats) {
-		console.log(key, stats[key])
-	}
-}
-
-/**
- * @class
- * @public
- */
-class Board {
-	colorMapping = {
-		0: "#ffffff",
-		1: "#000000",
-		2: "#2450a4",
-		3: "#00a368",
-		4: "#be0039",
-		5: "#ffa800",
-		6: "#FFFF00",
-		7: "#6d482f",
-		8: "#811e9f",
-		9: "#b44ac0",
-		10: "#7eed56",
-		11: "#3690ea",
-		12: "#be0049",
-		13: "#ffd631",
-		14: "#6d001a",
-		15: "#e4abff",
-	};
-	dimension = 0;
-
-	/**
-	 * @type {Array}
-	 * @public
-	 */
-	pixels = null;
-
-
-	/**
-	 * @private
-	 */
-	pixelColourToFill = "";
-
-	/**
-	 * @type {HTMLCanvasElement}
-	 * @public
-	 */
-	canvas = null;
-
-	/**
-	 * @param {number} dimension board dimension - creates a board of dimension x dimension size 
-	 * @param {HTMLCanvasElement} canvas canvas that this board will render to
-	 */
-	constructor(dimension, canvas) {
-		this.canvas = canvas;
-		this.dimension = dimension;
-		// this.pixels = new Uint8ClampedArray(dimension * dimension * 4)
-		this.pixels = new Array(this.dimension * this.dimension)
-
-		for (let i = 0; i < this.pixels.length; i++) {
-			// this.pixels[i] = 255
-			this.pixels[i] = "#FFFFFF"
-		}
-	}
-
-	/**
-	 * render the board onto a canvas
-	 * @param {HTMLCanvasElement} canvas the canvas to render the board to 
-	 */
-	render() {
-		if (!this.canvas)
-			return;
-
-		const ctx = this.canvas.getContext("2d")
-		ctx.clearRect(0, 0, ctx.canvas.width, ctx.canvas.height)
-		ctx.putImageData(new ImageData(this.pixels, this.dimension, this.dimension), 0, 0)
-	}
-
-	getMousePos(canvas, evt) {
-		var rect = canvas.getBoundingClientRect() // abs. size of element
-
-		return {
-			x: Math.floor((evt.clientX - rect.left) / PIXEL_SCALE),   // scale mouse coordinates after they have
-			y: Math.floor((evt.clientY - rect.top) / PIXEL_SCALE)     // been adjusted to be relative to element
-		}
-	}
-
-	/**
-	 * writes a single pixel to the server
-	 * @param {HTMLCanvasElement} canvas the canvas to render to
-	 * @param {MouseEvent} event
-	*/
-	writePixel(canvas, event) {
-		const ctx = canvas.getContext("2d")
-
-		const rect = canvas.getBoundingClientRect()
-		const { x, y } = this.getMousePos(canvas, event)
-		if (x < 0 || x >= this.dimension || y < 0 || y >= this.dimension) {
-			return
-		}
-
-		console.log("x: " + x + " y: " + y)
-
-		// @TODO: chcek if 5 mins is over
-		// Push update using /api/writepixel
-
-		const color = this.getKeyByValue(this.colorMapping, this.pixelColourToFill)
-		if (color != null || color != undefined)
-		{
-			API_WritePixel(x, y, color, localStorage.getItem(USERNAME_KEY))
-		}
-	}
-
-	/**
-	 * @private
-	 */
-	generateRandomUser()
-	{
-		let username = "user"
-		for (let i = 0; i < 5; i++)
-		{			
-			username += Math.trunc(Math.random() * 10).toString()
-		}
-
-		return username
-	}
-
-	/**
-	 * this function is used to receive the board from the bitefield and update it locally
-	*/
-	downloadLatestBoard() {
-		FetchBoard(`${GetEndpoint()}/api/board`, (pixels, err) => {
-			if (err) {
-				console.error("FetchBoard: ", err)
-				return
-			}
-
-			const encoder = new TextEncoder("utf-8")
-			const buf = new DataView(new ArrayBuffer(pixels.length))
-			for (let i = 0; i < pixels.length; i++) {
-				buf.setUint8(i, encoder.encode(pixels[i])[0])
-			}
-
-			const responseArray = new Uint8Array(buf.buffer)
-			
-			// now iterate and get the low and high and put in new array
-			var bytesArray = []
-			responseArray.forEach((pixelByte, _) => {
-				var firstPixel = pixelByte >> 4
-				var secondPixel = pixelByte & 0x0F
-				// find each of their respective colour
-				var firstPixelColour = this.getColorMapping()[firstPixel]
-				var secondPixelColour = this.getColorMapping()[secondPixel]
-
-				bytesArray.push(firstPixelColour)
-				bytesArray.push(secondPixelColour)
-			})
-
-			this.UpdateFullBoard(bytesArray)
-		})
-	}
-
-	/**
-	 * @private
-	 * @param {Uint8ClampedArray} pixels
-	 */
-	UpdateFullBoard(pixels) {
-		this.pixels = pixels
-		renderer.draw()
-	}
-
-	/**
-	 * 
-	 * @param {MessageEvent} ev 
-	 */
-	HandlePixelUpdate(ev) {
-		const update = JSON.parse(ev.data)
-		const hexColor = this.colorMapping[update.color]
-		this.pixels[(this.dimension * update.y) + update.x] = hexColor
-
-		renderer.DrawSinglePixel(update.x, update.y)
-	}
-
-	convertToRgb(colour) {
-		var aRgbHex = colour.match(/.{1,2}/g);
-		var aRgb = [
-			parseInt(aRgbHex[0], 16),
-			parseInt(aRgbHex[1], 16),
-			parseInt(aRgbHex[2], 16),
-		];
-		return aRgb;
-	}
-
-	setSelectedColor(e) {
-		this.pixelColourToFill = e;
-	}
-
-	getKeyByValue(object, value) {
-		return Object.keys(object).find((key) => object[key] === value);
-	}
-
-	getColorMapping() {
-		return this.colorMapping;
-	}
-
-	getDimension() {
-		return this.dimension
-	}
-}
-
-function CreatePalette() {
-	// render the button for palette
-	var palette = document.getElementById("palette");
-	var colorMapping = board.getColorMapping()
-
-	Object.keys(colorMapping).forEach((key) => {
-		var button = document.createElement("button");
-		button.classList.add("palette-colour");
-		button.style.backgroundColor = colorMapping[key];
-		button.addEventListener("click", function () {
-			board.setSelectedColor(colorMapping[key]);
-		});
-		palette.appendChild(button);
-	})
-}
-
-window.onload = async function () {
-	const canvas = document.getElementById("grid");
-	board = new Board(1000, canvas);
-	
-	let username = prompt("Please enter your name")
-	localStorage.setItem(USERNAME_KEY, username)
-
-	await InitAPIConnection((ev) => board.HandlePixelUpdate(ev))
-
-	board.downloadLatestBoard();
-	setInterval(() => {
-		console.log("Downloading full snapshot at ", Date.now())
-		board.downloadLatestBoard()
-	}, 5000)
-	CreatePalette();
-	const zoomOut = document.getElementById("zoomOut");
-	zoomOut.addEventListener('click', () => {
-		adjustZoom(100 * -SCROLL_SENSITIVITY)
-	})
-
-	const zoomIn = document.getElementById("zoomIn");
-	zoomIn.addEventListener('click', () => {
-		adjustZoom(-100 * -SCROLL_SENSITIVITY)
-	})
-
-	canvas.addEventListener("mouseup", (e) => board.writePixel(canvas, e));
-
-	renderer = new Renderer(canvas)
-};
+const USERNAME_KEY = 'username'
+// updates kept around to be re-applied on top of a snapshot that doesn't include them yet
+const MAX_RECENT_UPDATES = 1000
+/**
+ * @type {Board}
+ */
+var board
+
+/**
+ * @type {Renderer}
+ */
+var renderer
+
+/**
+ * @param {Object} stats 
+ */
+function LogStats(stats) {
+	// console.clear()
+	for (const key in stats) {
+		console.log(key, stats[key])
+	}
+}
+
+/**
+ * @class
+ * @public
+ */
+class Board {
+	/**
+	 * hex value of every color index, loaded from /api/palette
+	 * @type {Object<number, string>}
+	 */
+	colorMapping = {};
+
+	/**
+	 * name of every color index, loaded from /api/palette
+	 * @type {Object<number, string>}
+	 */
+	colorNames = {};
+
+	/**
+	 * board dimensions in pixels, taken from the latest snapshot since admins can expand the board
+	 * @type {number}
+	 */
+	width = 0;
+	height = 0;
+
+	/**
+	 * version of the latest board snapshot, updates at or below it are already part of the board
+	 * @type {number}
+	 */
+	version = 0;
+
+	/**
+	 * @type {Array}
+	 * @private
+	 */
+	recentUpdates = [];
+
+	/**
+	 * updates echoed to this user only, they are not part of any snapshot so they are kept
+	 * until another update overwrites the pixel, keyed by packed position
+	 * @type {Map<number, Object>}
+	 * @private
+	 */
+	echoedUpdates = new Map();
+
+	/**
+	 * @type {Array}
+	 * @public
+	 */
+	pixels = null;
+
+
+	/**
+	 * @private
+	 */
+	pixelColourToFill = "";
+
+	/**
+	 * @type {HTMLCanvasElement}
+	 * @public
+	 */
+	canvas = null;
+
+	/**
+	 * @param {number} width board width, replaced by the one of the first snapshot
+	 * @param {number} height board height, replaced by the one of the first snapshot
+	 * @param {HTMLCanvasElement} canvas canvas that this board will render to
+	 */
+	constructor(width, height, canvas) {
+		this.canvas = canvas;
+		this.width = width;
+		this.height = height;
+		// this.pixels = new Uint8ClampedArray(width * height * 4)
+		this.pixels = new Array(this.width * this.height)
+
+		for (let i = 0; i < this.pixels.length; i++) {
+			// this.pixels[i] = 255
+			this.pixels[i] = "#FFFFFF"
+		}
+	}
+
+	/**
+	 * render the board onto a canvas
+	 * @param {HTMLCanvasElement} canvas the canvas to render the board to 
+	 */
+	render() {
+		if (!this.canvas)
+			return;
+
+		const ctx = this.canvas.getContext("2d")
+		ctx.clearRect(0, 0, ctx.canvas.width, ctx.canvas.height)
+		ctx.putImageData(new ImageData(this.pixels, this.width, this.height), 0, 0)
+	}
+
+	getMousePos(canvas, evt) {
+		var rect = canvas.getBoundingClientRect() // abs. size of element
+
+		return {
+			x: Math.floor((evt.clientX - rect.left) / PIXEL_SCALE),   // scale mouse coordinates after they have
+			y: Math.floor((evt.clientY - rect.top) / PIXEL_SCALE)     // been adjusted to be relative to element
+		}
+	}
+
+	/**
+	 * writes a single pixel to the server
+	 * @param {HTMLCanvasElement} canvas the canvas to render to
+	 * @param {MouseEvent} event
+	*/
+	writePixel(canvas, event) {
+		const ctx = canvas.getContext("2d")
+
+		const rect = canvas.getBoundingClientRect()
+		const { x, y } = this.getMousePos(canvas, event)
+		if (x < 0 || x >= this.width || y < 0 || y >= this.height) {
+			return
+		}
+
+		console.log("x: " + x + " y: " + y)
+
+		// @TODO: chcek if 5 mins is over
+		// Push update using /api/writepixel
+
+		const color = this.getKeyByValue(this.colorMapping, this.pixelColourToFill)
+		if (color != null || color != undefined)
+		{
+			API_WritePixel(x, y, color).then(UpdateCooldown)
+		}
+	}
+
+	/**
+	 * @private
+	 */
+	generateRandomUser()
+	{
+		let username = "user"
+		for (let i = 0; i < 5; i++)
+		{			
+			username += Math.trunc(Math.random() * 10).toString()
+		}
+
+		return username
+	}
+
+	/**
+	 * this function is used to receive the board from the bitefield and update it locally
+	*/
+	downloadLatestBoard() {
+		FetchBoard(`${GetEndpoint()}/api/board`, (pixels, err, version, width, height) => {
+			if (err) {
+				console.error("FetchBoard: ", err)
+				return
+			}
+
+			// a slower request may finish after a newer snapshot was already applied
+			if (version < this.version) {
+				return
+			}
+
+			// FetchBoard unpacks the board into one color index per pixel whatever its bits per pixel,
+			// indices missing from the palette are drawn with its first color
+			var bytesArray = []
+			pixels.forEach((colorIndex, _) => {
+				bytesArray.push(this.getColorMapping()[colorIndex] ?? this.getColorMapping()[0])
+			})
+
+			this.width = width
+			this.height = height
+
+			this.version = version
+			API_SetResumePoint(version)
+
+			// re-apply the updates that happened after the snapshot was taken
+			this.recentUpdates = this.recentUpdates.filter((update) => update.seq > version)
+			for (const update of this.recentUpdates) {
+				bytesArray[(this.width * update.y) + update.x] = this.colorMapping[update.color]
+			}
+			for (const update of this.echoedUpdates.values()) {
+				bytesArray[(this.width * update.y) + update.x] = this.colorMapping[update.color]
+			}
+
+			this.UpdateFullBoard(bytesArray)
+		})
+	}
+
+	/**
+	 * @private
+	 * @param {Uint8ClampedArray} pixels
+	 */
+	UpdateFullBoard(pixels) {
+		this.pixels = pixels
+		renderer.draw()
+	}
+
+	/**
+	 * 
+	 * @param {MessageEvent} ev 
+	 */
+	HandlePixelUpdate(ev) {
+		const update = JSON.parse(ev.data)
+		if (update.type === "resync") {
+			// the server could not replay what we missed while disconnected, or the board sequence was
+			// reset and starts again below our version, so whatever board it serves now is the latest
+			this.version = 0
+			this.recentUpdates = []
+			this.downloadLatestBoard()
+			return
+		}
+
+		const position = (update.y << 16) | update.x
+		if (update.seq === 0) {
+			// an update with no place in the board sequence was only echoed back to us
+			this.echoedUpdates.set(position, update)
+		} else {
+			// already part of the latest snapshot
+			if (update.seq <= this.version) {
+				return
+			}
+
+			this.echoedUpdates.delete(position)
+			this.recentUpdates.push(update)
+			if (this.recentUpdates.length > MAX_RECENT_UPDATES) {
+				this.recentUpdates.shift()
+			}
+		}
+
+		// the board was expanded, the pixel shows up with the next snapshot
+		if (update.x >= this.width || update.y >= this.height) {
+			return
+		}
+
+		const hexColor = this.colorMapping[update.color]
+		this.pixels[(this.width * update.y) + update.x] = hexColor
+
+		renderer.DrawSinglePixel(update.x, update.y)
+	}
+
+	convertToRgb(colour) {
+		var aRgbHex = colour.match(/.{1,2}/g);
+		var aRgb = [
+			parseInt(aRgbHex[0], 16),
+			parseInt(aRgbHex[1], 16),
+			parseInt(aRgbHex[2], 16),
+		];
+		return aRgb;
+	}
+
+	setSelectedColor(e) {
+		this.pixelColourToFill = e;
+	}
+
+	getKeyByValue(object, value) {
+		return Object.keys(object).find((key) => object[key] === value);
+	}
+
+	getColorMapping() {
+		return this.colorMapping;
+	}
+
+	/**
+	 * @param {Array<{name: string, hex: string}>} palette colors ordered by color index
+	 */
+	setPalette(palette) {
+		palette.forEach((color, index) => {
+			this.colorMapping[index] = color.hex
+			this.colorNames[index] = color.name
+		})
+	}
+
+	getDimensions() {
+		return { width: this.width, height: this.height }
+	}
+}
+
+function CreatePalette() {
+	// render the button for palette
+	var palette = document.getElementById("palette");
+	var colorMapping = board.getColorMapping()
+
+	Object.keys(colorMapping).forEach((key) => {
+		var button = document.createElement("button");
+		button.classList.add("palette-colour");
+		button.style.backgroundColor = colorMapping[key];
+		button.title = board.colorNames[key];
+		button.addEventListener("click", function () {
+			board.setSelectedColor(colorMapping[key]);
+		});
+		palette.appendChild(button);
+	})
+}
+
+/**
+ * id of the interval counting down the cooldown
+ * @type {number}
+ */
+var cooldownTimer = 0
+
+/**
+ * counts down to the next placement of the user, the deadline is corrected by how far our clock is
+ * from the one of the server
+ */
+async function UpdateCooldown() {
+	const status = await API_GetUser()
+	if (!status) {
+		return
+	}
+
+	const offset = Date.now() - Date.parse(status.serverTime)
+	const deadline = Date.parse(status.nextPlacementAt) + offset
+	const element = document.getElementById("cooldown")
+
+	clearInterval(cooldownTimer)
+	const tick = () => {
+		const seconds = Math.ceil((deadline - Date.now()) / 1000)
+		if (seconds <= 0) {
+			element.textContent = ""
+			clearInterval(cooldownTimer)
+			return
+		}
+
+		element.textContent = `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, "0")}`
+	}
+	tick()
+	cooldownTimer = setInterval(tick, 1000)
+}
+
+/**
+ * subscribe to updates for the part of the board that is on screen
+ */
+function SubscribeToVisibleRegion() {
+	const rect = board.canvas.getBoundingClientRect()
+	const left = Math.max(0, -rect.left)
+	const top = Math.max(0, -rect.top)
+	const right = Math.min(rect.width, window.innerWidth - rect.left)
+	const bottom = Math.min(rect.height, window.innerHeight - rect.top)
+	if (right <= left || bottom <= top) {
+		return
+	}
+
+	const x = Math.floor(left / PIXEL_SCALE)
+	const y = Math.floor(top / PIXEL_SCALE)
+	const width = Math.min(board.width, Math.ceil(right / PIXEL_SCALE)) - x
+	const height = Math.min(board.height, Math.ceil(bottom / PIXEL_SCALE)) - y
+	if (width > 0 && height > 0) {
+		API_SubscribeToRegion(x, y, width, height)
+	}
+}
+
+window.onload = async function () {
+	const canvas = document.getElementById("grid");
+	board = new Board(0, 0, canvas);
+	
+	while (!API_IsAuthenticated()) {
+		const username = prompt("Please enter your name")
+		const password = prompt("Please enter your password, new names are registered with it")
+		if (!(await API_Authenticate(username, password))) {
+			alert("Could not log in, the name may be taken or the password is wrong.")
+		}
+	}
+
+	await InitAPIConnection((ev) => board.HandlePixelUpdate(ev))
+	board.setPalette(await API_GetPalette())
+
+	board.downloadLatestBoard();
+	setInterval(() => {
+		console.log("Downloading full snapshot at ", Date.now())
+		board.downloadLatestBoard()
+	}, 5000)
+	CreatePalette();
+	UpdateCooldown();
+	const zoomOut = document.getElementById("zoomOut");
+	zoomOut.addEventListener('click', () => {
+		adjustZoom(100 * -SCROLL_SENSITIVITY)
+	})
+
+	const zoomIn = document.getElementById("zoomIn");
+	zoomIn.addEventListener('click', () => {
+		adjustZoom(-100 * -SCROLL_SENSITIVITY)
+	})
+
+	canvas.addEventListener("mouseup", (e) => board.writePixel(canvas, e));
+
+	renderer = new Renderer(canvas)
+
+	SubscribeToVisibleRegion()
+	window.addEventListener("scroll", SubscribeToVisibleRegion)
+	window.addEventListener("resize", SubscribeToVisibleRegion)
+};
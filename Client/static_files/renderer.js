@@ -108,6 +108,7 @@ function handlePinch(e) {
 function adjustZoom(zoomAmount) {
     PIXEL_SCALE = Clamp(PIXEL_SCALE + zoomAmount, MIN_ZOOM, MAX_ZOOM)
     renderer.draw()
+    SubscribeToVisibleRegion()
 }
 
 class Renderer {
@@ -127,8 +128,8 @@ class Renderer {
         this.outputCanvas = canvas
         this.scratchCanvas = document.createElement('canvas')
         this.scratchCanvas.hidden = true
-        this.scratchCanvas.width = 1000
-        this.scratchCanvas.height = 1000
+        this.scratchCanvas.width = board.width
+        this.scratchCanvas.height = board.height
 
         ctx = canvas.getContext("2d")
         ctx.imageSmoothingEnabled = false
@@ -156,7 +157,7 @@ class Renderer {
         const pixelSize = PIXEL_SCALE
 
         let drawX = x * pixelSize, drawY = y * pixelSize
-        const offset = (y * board.dimension) + x
+        const offset = (y * board.width) + x
         ctx.fillStyle = board.pixels[offset]
         drawRect(drawX, drawY, pixelSize, pixelSize, ctx)
     }
@@ -166,7 +167,7 @@ class Renderer {
         const pixelSize = PIXEL_SCALE
         let drawX = 0, drawY = 0
         for (let i = 0; i < board.pixels.length; i++){
-            if (i > 0 && (i % board.dimension == 0)) {
+            if (i > 0 && (i % board.width == 0)) {
                 drawX = 0
                 drawY += pixelSize
             }
@@ -201,8 +202,10 @@ class Renderer {
     draw() {
         const scratchCtx = this.scratchCanvas.getContext("2d")
         const canvas = this.outputCanvas
-        canvas.width = board.dimension * PIXEL_SCALE
-        canvas.height = board.dimension * PIXEL_SCALE
+        canvas.width = board.width * PIXEL_SCALE
+        canvas.height = board.height * PIXEL_SCALE
+        this.scratchCanvas.width = board.width
+        this.scratchCanvas.height = board.height
 
         // Translate to the canvas centre before zooming - so you'll always zoom on what you're looking directly at
         // ctx.translate(window.innerWidth / 2, window.innerHeight / 2)
@@ -213,7 +216,7 @@ class Renderer {
         scratchCtx.clearRect(0, 0, window.innerWidth, window.innerHeight)
         this.SlowDraw()
 
-        // const scaledImage = this.scaleImageData(new ImageData(board.pixels, board.dimension, board.dimension), scaleFactor, ctx)
+        // const scaledImage = this.scaleImageData(new ImageData(board.pixels, board.width, board.height), scaleFactor, ctx)
         // ctx.putImageData(scaledImage, 0, 0)
         // ctx.drawImage(this.scratchCanvas, 0, 0)
 
@@ -0,0 +1,117 @@
+// Package bans stores user bans in redis, shared by WritePixel which enforces them and the
+// Admin lambda which manages them.
+package bans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// hash of username to the json encoded Ban of the user
+const REDIS_BANS_KEY = "Bans"
+
+const (
+	BAN_TYPE_BAN    = "ban"    // writes are rejected with 403
+	BAN_TYPE_SHADOW = "shadow" // writes look accepted but are only echoed to the user's own sockets
+)
+
+var ErrInvalidBan = errors.New("invalid ban")
+
+type Ban struct {
+	User      string     `json:"user"`
+	Type      string     `json:"type"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // nil for a permanent ban
+}
+
+func (ban *Ban) Validate() error {
+	if ban.User == "" || (ban.Type != BAN_TYPE_BAN && ban.Type != BAN_TYPE_SHADOW) {
+		return ErrInvalidBan
+	}
+
+	return nil
+}
+
+// Expired reports whether the ban is over at now, bans stored with the zero time before ExpiresAt
+// became optional are permanent too
+func (ban *Ban) Expired(now time.Time) bool {
+	return ban.ExpiresAt != nil && !ban.ExpiresAt.IsZero() && !now.Before(*ban.ExpiresAt)
+}
+
+// Redis_GetBan returns the active ban of the user, or nil if the user is not banned. Expired bans
+// are removed when they are read.
+func Redis_GetBan(ctx context.Context, client *redis.Client, user string) (*Ban, error) {
+	serialized, err := client.HGet(ctx, REDIS_BANS_KEY, user).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ban Ban
+	err = json.Unmarshal(serialized, &ban)
+	if err != nil {
+		return nil, err
+	}
+
+	if ban.Expired(time.Now()) {
+		return nil, client.HDel(ctx, REDIS_BANS_KEY, user).Err()
+	}
+
+	return &ban, nil
+}
+
+// Redis_SetBan bans the user, replacing any previous ban
+func Redis_SetBan(ctx context.Context, client *redis.Client, ban Ban) error {
+	serialized, err := json.Marshal(ban)
+	if err != nil {
+		return err
+	}
+
+	return client.HSet(ctx, REDIS_BANS_KEY, ban.User, string(serialized)).Err()
+}
+
+func Redis_RemoveBan(ctx context.Context, client *redis.Client, user string) error {
+	return client.HDel(ctx, REDIS_BANS_KEY, user).Err()
+}
+
+// Redis_ListBans returns every active ban
+func Redis_ListBans(ctx context.Context, client *redis.Client) ([]Ban, error) {
+	entries, err := client.HGetAll(ctx, REDIS_BANS_KEY).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := []Ban{}
+	expired := []string{}
+	for user, serialized := range entries {
+		var ban Ban
+		err = json.Unmarshal([]byte(serialized), &ban)
+		if err != nil {
+			return nil, err
+		}
+
+		if ban.Expired(now) {
+			expired = append(expired, user)
+			continue
+		}
+
+		active = append(active, ban)
+	}
+
+	if len(expired) > 0 {
+		err = client.HDel(ctx, REDIS_BANS_KEY, expired...).Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
@@ -0,0 +1,143 @@
+package bans
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func setupRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	zero := time.Time{}
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		expired   bool
+	}{
+		{"permanent", nil, false},
+		{"permanent from before expiries were optional", &zero, false},
+		{"expires later", &future, false},
+		{"expires now", &now, true},
+		{"expired", &past, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ban := Ban{User: "alice", Type: BAN_TYPE_BAN, ExpiresAt: test.expiresAt}
+			if ban.Expired(now) != test.expired {
+				t.Fatalf("expected expired to be %v", test.expired)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		ban   Ban
+		valid bool
+	}{
+		{Ban{User: "alice", Type: BAN_TYPE_BAN}, true},
+		{Ban{User: "alice", Type: BAN_TYPE_SHADOW}, true},
+		{Ban{User: "", Type: BAN_TYPE_BAN}, false},
+		{Ban{User: "alice", Type: "mute"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.ban.Validate()
+		if (err == nil) != test.valid {
+			t.Fatalf("expected %+v to be valid: %v, got %v", test.ban, test.valid, err)
+		}
+	}
+}
+
+func TestPermanentBansLeaveOutTheExpiry(t *testing.T) {
+	serialized, err := json.Marshal(Ban{User: "alice", Type: BAN_TYPE_BAN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(serialized), "expiresAt") {
+		t.Fatalf("expected no expiresAt in %s", serialized)
+	}
+
+	var ban Ban
+	err = json.Unmarshal([]byte(`{"user": "alice", "type": "ban", "expiresAt": "2022-12-02T00:00:00Z"}`), &ban)
+	if err != nil || ban.ExpiresAt == nil || !ban.ExpiresAt.Equal(time.Date(2022, 12, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the ban to expire on 2022-12-02, got %v (%v)", ban.ExpiresAt, err)
+	}
+}
+
+func TestRedisBans(t *testing.T) {
+	client, server := setupRedis(t)
+	ctx := context.Background()
+	expiredAt := time.Now().Add(-time.Hour)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	for _, ban := range []Ban{
+		{User: "alice", Type: BAN_TYPE_BAN, Reason: "griefing"},
+		{User: "bob", Type: BAN_TYPE_SHADOW, ExpiresAt: &expiresAt},
+		{User: "carol", Type: BAN_TYPE_BAN, ExpiresAt: &expiredAt},
+		{User: "dave", Type: BAN_TYPE_BAN, ExpiresAt: &expiredAt},
+	} {
+		err := Redis_SetBan(ctx, client, ban)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ban, err := Redis_GetBan(ctx, client, "alice")
+	if err != nil || ban == nil || ban.Type != BAN_TYPE_BAN || ban.Reason != "griefing" || ban.ExpiresAt != nil {
+		t.Fatalf("expected alice to be banned for good, got %+v (%v)", ban, err)
+	}
+	ban, err = Redis_GetBan(ctx, client, "bob")
+	if err != nil || ban == nil || ban.ExpiresAt == nil || !ban.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("expected bob to be banned until %v, got %+v (%v)", expiresAt, ban, err)
+	}
+
+	// expired bans are removed when they are read
+	ban, err = Redis_GetBan(ctx, client, "carol")
+	if err != nil || ban != nil {
+		t.Fatalf("expected the ban of carol to have expired, got %+v (%v)", ban, err)
+	}
+	if server.HGet(REDIS_BANS_KEY, "carol") != "" {
+		t.Fatal("expected the expired ban of carol to be removed")
+	}
+
+	// and when they are listed
+	active, err := Redis_ListBans(ctx, client)
+	if err != nil || len(active) != 2 {
+		t.Fatalf("expected the bans of alice and bob, got %+v (%v)", active, err)
+	}
+	if server.HGet(REDIS_BANS_KEY, "dave") != "" {
+		t.Fatal("expected the expired ban of dave to be removed")
+	}
+
+	err = Redis_RemoveBan(ctx, client, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ban, err = Redis_GetBan(ctx, client, "alice")
+	if err != nil || ban != nil {
+		t.Fatalf("expected alice to be unbanned, got %+v (%v)", ban, err)
+	}
+
+	ban, err = Redis_GetBan(ctx, client, "erin")
+	if err != nil || ban != nil {
+		t.Fatalf("expected erin not to be banned, got %+v (%v)", ban, err)
+	}
+}
@@ -0,0 +1,256 @@
+// Package board keeps the dimensions and the pixel encoding of the board in redis so every
+// component lays out the packed bitfield the same way, and lets admins expand the board or widen
+// its pixels while it is live.
+package board
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"Common/boardimage"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// hash of "width" and "height" in pixels and "bitsPerPixel"
+const REDIS_BOARD_METADATA_KEY = "BoardMetadata"
+const REDIS_BITFIELD_KEY = "BoardBitfield"
+
+const METADATA_WIDTH_FIELD = "width"
+const METADATA_HEIGHT_FIELD = "height"
+const METADATA_BITS_PER_PIXEL_FIELD = "bitsPerPixel"
+
+// used while no metadata is stored in redis
+const DEFAULT_WIDTH = 1000
+const DEFAULT_HEIGHT = 1000
+const DEFAULT_BITS_PER_PIXEL = 4
+
+// keeps the full board within boardimage.MAX_IMAGE_DIMENSION and positions within 16 bits
+const MAX_DIMENSION = boardimage.MAX_IMAGE_DIMENSION
+
+// supported pixel encodings, 16, 32 and 256 colors
+var BITS_PER_PIXEL = []int{4, 5, 8}
+
+// attempts at re-laying out the board when pixels keep being written while it is converted
+const RELAYOUT_RETRIES = 10
+
+var ErrInvalidMetadata = errors.New("invalid board metadata")
+var ErrBoardBusy = errors.New("board kept changing while being re-laid out")
+
+type Metadata struct {
+	Width        int `json:"width"`
+	Height       int `json:"height"`
+	BitsPerPixel int `json:"bitsPerPixel"`
+}
+
+// Region is a rectangle of the board, in pixels
+type Region struct {
+	X      uint16
+	Y      uint16
+	Width  uint16
+	Height uint16
+}
+
+func DefaultMetadata() Metadata {
+	return Metadata{Width: DEFAULT_WIDTH, Height: DEFAULT_HEIGHT, BitsPerPixel: DEFAULT_BITS_PER_PIXEL}
+}
+
+func IsBitsPerPixel(bitsPerPixel int) bool {
+	for _, supported := range BITS_PER_PIXEL {
+		if bitsPerPixel == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (metadata Metadata) Validate() error {
+	if metadata.Width <= 0 || metadata.Height <= 0 || metadata.Width > MAX_DIMENSION || metadata.Height > MAX_DIMENSION {
+		return fmt.Errorf("%w, dimensions must be between 1 and %d", ErrInvalidMetadata, MAX_DIMENSION)
+	}
+
+	if !IsBitsPerPixel(metadata.BitsPerPixel) {
+		return fmt.Errorf("%w, bits per pixel must be one of %v", ErrInvalidMetadata, BITS_PER_PIXEL)
+	}
+
+	return nil
+}
+
+// Pixels returns the number of pixels on the board
+func (metadata Metadata) Pixels() int {
+	return metadata.Width * metadata.Height
+}
+
+// FullRegion returns the region covering the whole board
+func (metadata Metadata) FullRegion() Region {
+	return Region{X: 0, Y: 0, Width: uint16(metadata.Width), Height: uint16(metadata.Height)}
+}
+
+// Contains reports whether region is a non-empty rectangle within the board
+func (metadata Metadata) Contains(region Region) bool {
+	return region.Width > 0 && region.Height > 0 &&
+		int(region.X)+int(region.Width) <= metadata.Width && int(region.Y)+int(region.Height) <= metadata.Height
+}
+
+// Colors returns the number of colors a pixel can hold
+func (metadata Metadata) Colors() int {
+	return 1 << metadata.BitsPerPixel
+}
+
+// BitfieldSize returns the number of bytes of the packed bitfield
+func (metadata Metadata) BitfieldSize() int {
+	return (metadata.Pixels()*metadata.BitsPerPixel + 7) / 8
+}
+
+// ParseMetadata reads the fields of REDIS_BOARD_METADATA_KEY, missing fields keep their default so
+// boards created before the metadata was stored keep working
+func ParseMetadata(fields map[string]string) (Metadata, error) {
+	metadata := DefaultMetadata()
+	values := map[string]*int{
+		METADATA_WIDTH_FIELD:          &metadata.Width,
+		METADATA_HEIGHT_FIELD:         &metadata.Height,
+		METADATA_BITS_PER_PIXEL_FIELD: &metadata.BitsPerPixel,
+	}
+
+	for field, value := range values {
+		raw, ok := fields[field]
+		if !ok {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("invalid board %s %q", field, raw)
+		}
+		*value = parsed
+	}
+
+	return metadata, metadata.Validate()
+}
+
+func Redis_GetMetadata(ctx context.Context, client redis.Cmdable) (Metadata, error) {
+	fields, err := client.HGetAll(ctx, REDIS_BOARD_METADATA_KEY).Result()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return ParseMetadata(fields)
+}
+
+func Redis_SetMetadata(ctx context.Context, client redis.Cmdable, metadata Metadata) error {
+	return client.HSet(ctx, REDIS_BOARD_METADATA_KEY,
+		METADATA_WIDTH_FIELD, metadata.Width,
+		METADATA_HEIGHT_FIELD, metadata.Height,
+		METADATA_BITS_PER_PIXEL_FIELD, metadata.BitsPerPixel,
+	).Err()
+}
+
+// Redis_ReadBitfield reads the bitfield along with the metadata it is laid out for, an empty
+// board has no bitfield yet
+func Redis_ReadBitfield(ctx context.Context, client *redis.Client) ([]uint8, Metadata, error) {
+	tx := client.TxPipeline()
+	bitfieldCmd := tx.Get(ctx, REDIS_BITFIELD_KEY)
+	metadataCmd := tx.HGetAll(ctx, REDIS_BOARD_METADATA_KEY)
+	_, err := tx.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata, err := ParseMetadata(metadataCmd.Val())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	bitfield, err := bitfieldCmd.Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, Metadata{}, err
+	}
+
+	return bitfield, metadata, nil
+}
+
+// Relayout copies the pixels of a bitfield laid out for from into one laid out for to, pixels
+// outside of to are dropped and new pixels are 0
+func Relayout(bitfield []uint8, from Metadata, to Metadata) []uint8 {
+	relaid := make([]uint8, to.BitfieldSize())
+	for y := 0; y < from.Height && y < to.Height; y++ {
+		for x := 0; x < from.Width && x < to.Width; x++ {
+			col := boardimage.GetPixel(bitfield, y*from.Width+x, from.BitsPerPixel)
+			boardimage.SetPixel(relaid, y*to.Width+x, to.BitsPerPixel, col)
+		}
+	}
+
+	return relaid
+}
+
+// Redis_Relayout replaces the metadata with the one returned by change and converts the bitfield
+// to it. The bitfield is rewritten only if nothing was written to it while it was converted, see
+// WritePixel which reads the metadata in the same script that writes the pixel. It returns the
+// metadata before and after the change.
+func Redis_Relayout(ctx context.Context, client *redis.Client, change func(from Metadata) (Metadata, error)) (Metadata, Metadata, error) {
+	for attempt := 0; attempt < RELAYOUT_RETRIES; attempt++ {
+		var from, to Metadata
+		err := client.Watch(ctx, func(tx *redis.Tx) error {
+			var err error
+			from, err = Redis_GetMetadata(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			to, err = change(from)
+			if err == nil {
+				err = to.Validate()
+			}
+			if err != nil {
+				return err
+			}
+
+			bitfield, err := tx.Get(ctx, REDIS_BITFIELD_KEY).Bytes()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				// rows keep their offsets when only the height changes, the bitfield grows as pixels are written
+				if to.Width != from.Width || to.BitsPerPixel != from.BitsPerPixel {
+					pipe.Set(ctx, REDIS_BITFIELD_KEY, Relayout(bitfield, from, to), 0)
+				}
+				return Redis_SetMetadata(ctx, pipe, to)
+			})
+
+			return err
+		}, REDIS_BOARD_METADATA_KEY, REDIS_BITFIELD_KEY)
+
+		if err != redis.TxFailedErr {
+			return from, to, err
+		}
+	}
+
+	return Metadata{}, Metadata{}, ErrBoardBusy
+}
+
+// Redis_Expand grows the board to width x height, keeping every pixel where it is
+func Redis_Expand(ctx context.Context, client *redis.Client, width int, height int) (Metadata, Metadata, error) {
+	return Redis_Relayout(ctx, client, func(from Metadata) (Metadata, error) {
+		if width < from.Width || height < from.Height {
+			return Metadata{}, fmt.Errorf("%w, the board can only grow from %dx%d", ErrInvalidMetadata, from.Width, from.Height)
+		}
+
+		return Metadata{Width: width, Height: height, BitsPerPixel: from.BitsPerPixel}, nil
+	})
+}
+
+// Redis_WidenPixels converts the board to bitsPerPixel bits per pixel, pixels keep their color
+// index so it can only get wider
+func Redis_WidenPixels(ctx context.Context, client *redis.Client, bitsPerPixel int) (Metadata, Metadata, error) {
+	return Redis_Relayout(ctx, client, func(from Metadata) (Metadata, error) {
+		if bitsPerPixel < from.BitsPerPixel {
+			return Metadata{}, fmt.Errorf("%w, pixels can only get wider than %d bits", ErrInvalidMetadata, from.BitsPerPixel)
+		}
+
+		return Metadata{Width: from.Width, Height: from.Height, BitsPerPixel: bitsPerPixel}, nil
+	})
+}
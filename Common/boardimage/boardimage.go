@@ -0,0 +1,188 @@
+// Package boardimage reads and writes the pixels of the packed board bitfield, at any number of
+// bits per pixel, and renders it into images.
+package boardimage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+)
+
+// largest width or height of a rendered image, after scaling
+const MAX_IMAGE_DIMENSION = 4000
+
+const MAX_SCALE = 16
+
+var ErrInvalidOptions = errors.New("invalid board image options")
+
+// Options selects the part of the board to render and how much to scale it up
+type Options struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+	Scale  int
+}
+
+// ParseOptions reads the scale, x, y, w and h query parameters. The whole board is rendered at
+// scale 1 when they are not set, a crop needs all of x, y, w and h.
+func ParseOptions(query map[string]string, boardWidth int, boardHeight int) (Options, error) {
+	options := Options{X: 0, Y: 0, Width: boardWidth, Height: boardHeight, Scale: 1}
+
+	if raw, ok := query["scale"]; ok {
+		scale, err := strconv.Atoi(raw)
+		if err != nil || scale < 1 || scale > MAX_SCALE {
+			return Options{}, ErrInvalidOptions
+		}
+
+		options.Scale = scale
+	}
+
+	keys := []string{"x", "y", "w", "h"}
+	values := make([]int, len(keys))
+	present := 0
+	for i, key := range keys {
+		raw, ok := query[key]
+		if !ok {
+			continue
+		}
+
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return Options{}, ErrInvalidOptions
+		}
+
+		values[i] = value
+		present++
+	}
+
+	if present != 0 && present != len(keys) {
+		return Options{}, ErrInvalidOptions
+	}
+
+	if present == len(keys) {
+		options.X, options.Y, options.Width, options.Height = values[0], values[1], values[2], values[3]
+	}
+
+	if options.Width == 0 || options.Height == 0 || options.X+options.Width > boardWidth || options.Y+options.Height > boardHeight {
+		return Options{}, ErrInvalidOptions
+	}
+
+	if options.Width*options.Scale > MAX_IMAGE_DIMENSION || options.Height*options.Scale > MAX_IMAGE_DIMENSION {
+		return Options{}, ErrInvalidOptions
+	}
+
+	return options, nil
+}
+
+// ParseHexColor parses a "#rrggbb" color, the leading # is optional
+func ParseHexColor(hex string) (color.RGBA, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", hex)
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", hex)
+	}
+
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xFF}, nil
+}
+
+// PaletteFromHex builds a palette from "#rrggbb" colors, ordered by color index
+func PaletteFromHex(colors []string) (color.Palette, error) {
+	palette := make(color.Palette, 0, len(colors))
+	for _, hex := range colors {
+		c, err := ParseHexColor(hex)
+		if err != nil {
+			return nil, err
+		}
+
+		palette = append(palette, c)
+	}
+
+	return palette, nil
+}
+
+// GetBits returns the count bits starting at bit of the packed bitfield, most significant bit
+// first like redis BITFIELD. Bits past the end have not been written yet and are 0. count is at
+// most 8.
+func GetBits(bitfield []uint8, bit int, count int) uint8 {
+	window := uint16(0)
+	if bit/8 < len(bitfield) {
+		window = uint16(bitfield[bit/8]) << 8
+	}
+	if bit/8+1 < len(bitfield) {
+		window |= uint16(bitfield[bit/8+1])
+	}
+
+	return uint8(window>>(16-bit%8-count)) & (1<<count - 1)
+}
+
+// SetBits overwrites the count bits starting at bit, see GetBits for the layout
+func SetBits(bitfield []uint8, bit int, count int, value uint8) {
+	shift := 16 - bit%8 - count
+	mask := uint16(1<<count-1) << shift
+	window := uint16(bitfield[bit/8]) << 8
+	if shift < 8 {
+		window |= uint16(bitfield[bit/8+1])
+	}
+
+	window = (window &^ mask) | (uint16(value)<<shift)&mask
+	bitfield[bit/8] = uint8(window >> 8)
+	if shift < 8 {
+		bitfield[bit/8+1] = uint8(window)
+	}
+}
+
+// GetPixel returns the color index of the pixel at index in a bitfield packed with bitsPerPixel
+// bits per pixel, with 4 bits the first pixel of a byte is in its high bits
+func GetPixel(bitfield []uint8, index int, bitsPerPixel int) uint8 {
+	return GetBits(bitfield, index*bitsPerPixel, bitsPerPixel)
+}
+
+// SetPixel overwrites the color index of the pixel at index, see GetPixel for the layout
+func SetPixel(bitfield []uint8, index int, bitsPerPixel int, colorIndex uint8) {
+	SetBits(bitfield, index*bitsPerPixel, bitsPerPixel, colorIndex)
+}
+
+// Render draws the part of the board selected by options, color indices missing from the
+// palette are drawn with its first color
+func Render(bitfield []uint8, boardWidth int, bitsPerPixel int, palette color.Palette, options Options) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, options.Width*options.Scale, options.Height*options.Scale), palette)
+
+	for y := 0; y < options.Height; y++ {
+		for x := 0; x < options.Width; x++ {
+			colorIndex := GetPixel(bitfield, (options.Y+y)*boardWidth+options.X+x, bitsPerPixel)
+			if int(colorIndex) >= len(palette) {
+				colorIndex = 0
+			}
+
+			for sy := 0; sy < options.Scale; sy++ {
+				offset := img.PixOffset(x*options.Scale, y*options.Scale+sy)
+				for sx := 0; sx < options.Scale; sx++ {
+					img.Pix[offset+sx] = colorIndex
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// EncodePNG renders the board with Render and encodes it as a png
+func EncodePNG(bitfield []uint8, boardWidth int, bitsPerPixel int, palette color.Palette, options Options) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, Render(bitfield, boardWidth, bitsPerPixel, palette, options))
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+// Package config reads the settings the lambdas, the servers and the tools share from the
+// environment and connects to the stores they name.
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"Common/store"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/gocql/gocql"
+)
+
+const CASSANDRA_CONNECT_TIMEOUT = 6 * time.Second
+
+// GetEnvOrDefault returns the value of the environment variable key, or fallback when it is not
+// set at all. A variable set to the empty string is returned as is.
+func GetEnvOrDefault(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	return value
+}
+
+// Redis_Init connects to the redis at REDIS_ENDPOINT and REDIS_PORT
+func Redis_Init() (*redis.Client, error) {
+	addr := fmt.Sprintf("%s:%s", GetEnvOrDefault("REDIS_ENDPOINT", "127.0.0.1"), GetEnvOrDefault("REDIS_PORT", "6379"))
+	client := redis.NewClient(&redis.Options{Addr: addr})
+
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping redis at %s - %w", addr, err)
+	}
+
+	return client, nil
+}
+
+// Cassandra_Init opens a session of the KEYSPACE_NAME keyspace at CASSANDRA_ENDPOINT
+func Cassandra_Init() (*gocql.Session, error) {
+	cluster := gocql.NewCluster(GetEnvOrDefault("CASSANDRA_ENDPOINT", "cassandra.us-east-1.amazonaws.com"))
+	cluster.Port = 9142
+	if port, err := strconv.Atoi(os.Getenv("CASSANDRA_PORT")); err == nil {
+		cluster.Port = port
+	}
+	// add your service specific credentials
+	cluster.Authenticator = gocql.PasswordAuthenticator{
+		Username: os.Getenv("AUTHENTICATION_USERNAME"),
+		Password: os.Getenv("AUTHENTICATION_PASSWORD"),
+	}
+	// provide the path to the sf-class2-root.crt, an empty CASSANDRA_CA_PATH
+	// disables TLS for local clusters
+	caPath := GetEnvOrDefault("CASSANDRA_CA_PATH", "./sf-class2-root.crt")
+	if caPath != "" {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 caPath,
+			EnableHostVerification: false,
+		}
+	}
+
+	// Override default Consistency to LocalQuorum
+	cluster.Consistency = gocql.LocalQuorum
+	cluster.DisableInitialHostLookup = false
+	cluster.ProtoVersion = 4
+	cluster.Keyspace = GetKeyspace()
+	cluster.ConnectTimeout = CASSANDRA_CONNECT_TIMEOUT
+
+	return cluster.CreateSession()
+}
+
+func GetKeyspace() string {
+	return os.Getenv("KEYSPACE_NAME")
+}
+
+// GetCassandraTables names the tables of the keyspace
+func GetCassandraTables() store.CassandraTables {
+	return store.CassandraTables{
+		Pixels:     GetEnvOrDefault("KEYSPACE_TABLE", "rplace"),
+		Placements: GetEnvOrDefault("KEYSPACE_PLACEMENTS_TABLE", "placements"),
+		History:    GetEnvOrDefault("KEYSPACE_HISTORY_TABLE", "pixel_history"),
+		Bans:       GetEnvOrDefault("KEYSPACE_BANS_TABLE", "bans"),
+		Users:      GetEnvOrDefault("KEYSPACE_USERS_TABLE", "users"),
+	}
+}
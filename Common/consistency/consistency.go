@@ -0,0 +1,226 @@
+// Package consistency compares the live board in redis with the rplace table it is rebuilt from
+// and repairs the pixels they disagree on. WritePixel writes redis first and only logs a failed
+// Cassandra write, so the two can drift apart.
+package consistency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"Common/board"
+	"Common/boardimage"
+	"Common/store"
+)
+
+// directions of a repair, the first store is the one that is trusted
+const (
+	DIRECTION_TO_REDIS     = "cassandra-to-redis"
+	DIRECTION_TO_CASSANDRA = "redis-to-cassandra"
+)
+
+const DEFAULT_CHUNK_SIZE = 100
+const DEFAULT_SAMPLES = 20
+
+// recorded as the author of pixels copied to Cassandra, the user who placed them is not in redis
+const REPAIR_USER = "[repair]"
+
+// pixels written to a store at a time by Repair
+const REPAIR_BATCH_SIZE = 500
+
+var ErrInvalidDirection = fmt.Errorf("direction must be %s or %s", DIRECTION_TO_REDIS, DIRECTION_TO_CASSANDRA)
+
+type Options struct {
+	ChunkSize int // side of the square chunks mismatches are totaled in, DEFAULT_CHUNK_SIZE when 0
+	Samples   int // mismatches listed in the report, DEFAULT_SAMPLES when 0
+}
+
+// Mismatch is a pixel whose color in the board differs from its row in rplace
+type Mismatch struct {
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Redis     uint8  `json:"redis"`
+	Cassandra uint8  `json:"cassandra"`         // 0 for a missing row
+	Missing   bool   `json:"missing,omitempty"` // painted in the board but never written to rplace
+	User      string `json:"user,omitempty"`    // owner in rplace
+}
+
+// Chunk totals the mismatches of the ChunkSize x ChunkSize square at X, Y
+type Chunk struct {
+	X          int `json:"x"`
+	Y          int `json:"y"`
+	Mismatches int `json:"mismatches"`
+}
+
+type Report struct {
+	Metadata    board.Metadata `json:"metadata"`
+	RowsRead    int            `json:"rowsRead"`
+	RowsSkipped int            `json:"rowsSkipped"` // unreadable, outside of the board or with a color it can't hold
+	Mismatches  int            `json:"mismatches"`  // missing rows included
+	Missing     int            `json:"missing"`
+	ChunkSize   int            `json:"chunkSize"`
+	Chunks      []Chunk        `json:"chunks"`  // chunks with mismatches, most first
+	Samples     []Mismatch     `json:"samples"` // the first mismatches in board order
+}
+
+// Check compares a snapshot of the board with every row of rplace. Pixels that disagree are read
+// again from both stores and only reported if they still do, so pixels written during the scan
+// are not mistaken for drift. It returns every mismatch in board order along with the report.
+func Check(ctx context.Context, boardStore store.BoardStore, pixels store.PixelRepository, options Options) (Report, []Mismatch, error) {
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = DEFAULT_CHUNK_SIZE
+	}
+	if options.Samples <= 0 {
+		options.Samples = DEFAULT_SAMPLES
+	}
+
+	bitfield, _, metadata, err := boardStore.ReadBoard(ctx)
+	if err != nil {
+		return Report{}, nil, fmt.Errorf("failed to read the board - %w", err)
+	}
+
+	report := Report{Metadata: metadata, ChunkSize: options.ChunkSize, Chunks: []Chunk{}, Samples: []Mismatch{}}
+	written := make([]bool, metadata.Pixels())
+	candidates := []Mismatch{}
+	err = pixels.Scan(ctx, func(pixel store.Pixel, err error) error {
+		report.RowsRead++
+		if err != nil || int(pixel.X) >= metadata.Width || int(pixel.Y) >= metadata.Height || int(pixel.Col) >= metadata.Colors() {
+			report.RowsSkipped++
+			return nil
+		}
+
+		index := int(pixel.Y)*metadata.Width + int(pixel.X)
+		written[index] = true
+		col := boardimage.GetPixel(bitfield, index, metadata.BitsPerPixel)
+		if col != pixel.Col {
+			candidates = append(candidates, Mismatch{X: int(pixel.X), Y: int(pixel.Y), Redis: col, Cassandra: pixel.Col, User: pixel.User})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Report{}, nil, fmt.Errorf("failed to scan the pixels - %w", err)
+	}
+
+	// pixels are 0 until they are written, a painted pixel without a row was lost on its way to rplace
+	for index, ok := range written {
+		if ok {
+			continue
+		}
+
+		col := boardimage.GetPixel(bitfield, index, metadata.BitsPerPixel)
+		if col != 0 {
+			candidates = append(candidates, Mismatch{X: index % metadata.Width, Y: index / metadata.Width, Redis: col, Missing: true})
+		}
+	}
+
+	mismatches := []Mismatch{}
+	for _, candidate := range candidates {
+		mismatch, ok, err := confirm(ctx, boardStore, pixels, candidate)
+		if err != nil {
+			return Report{}, nil, err
+		}
+		if ok {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Y != mismatches[j].Y {
+			return mismatches[i].Y < mismatches[j].Y
+		}
+		return mismatches[i].X < mismatches[j].X
+	})
+
+	chunks := make(map[[2]int]int)
+	for _, mismatch := range mismatches {
+		report.Mismatches++
+		if mismatch.Missing {
+			report.Missing++
+		}
+		if len(report.Samples) < options.Samples {
+			report.Samples = append(report.Samples, mismatch)
+		}
+		chunks[[2]int{mismatch.X / options.ChunkSize * options.ChunkSize, mismatch.Y / options.ChunkSize * options.ChunkSize}]++
+	}
+
+	for position, count := range chunks {
+		report.Chunks = append(report.Chunks, Chunk{X: position[0], Y: position[1], Mismatches: count})
+	}
+	sort.Slice(report.Chunks, func(i, j int) bool {
+		a, b := report.Chunks[i], report.Chunks[j]
+		if a.Mismatches != b.Mismatches {
+			return a.Mismatches > b.Mismatches
+		}
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+
+	return report, mismatches, nil
+}
+
+// confirm reads a pixel again from both stores, it is no longer a mismatch if they agree now
+func confirm(ctx context.Context, boardStore store.BoardStore, pixels store.PixelRepository, mismatch Mismatch) (Mismatch, bool, error) {
+	col, err := boardStore.GetPixel(ctx, mismatch.X, mismatch.Y)
+	if err != nil {
+		return mismatch, false, fmt.Errorf("failed to read pixel %d,%d from the board - %w", mismatch.X, mismatch.Y, err)
+	}
+
+	pixel, err := pixels.Read(ctx, uint16(mismatch.X), uint16(mismatch.Y))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return mismatch, false, fmt.Errorf("failed to read pixel %d,%d from the keyspace - %w", mismatch.X, mismatch.Y, err)
+	}
+
+	mismatch.Redis = col
+	mismatch.Missing = errors.Is(err, store.ErrNotFound)
+	mismatch.Cassandra = pixel.Col
+	mismatch.User = pixel.User
+
+	return mismatch, mismatch.Redis != mismatch.Cassandra, nil
+}
+
+// Repair makes the untrusted store of direction agree with the trusted one on every mismatch
+// Check returned for metadata. It returns the number of pixels it wrote before failing.
+func Repair(ctx context.Context, boardStore store.BoardStore, pixels store.PixelRepository, metadata board.Metadata, mismatches []Mismatch, direction string) (int, error) {
+	switch direction {
+	case DIRECTION_TO_REDIS:
+		repaired := 0
+		for start := 0; start < len(mismatches); start += REPAIR_BATCH_SIZE {
+			end := start + REPAIR_BATCH_SIZE
+			if end > len(mismatches) {
+				end = len(mismatches)
+			}
+
+			batch := make([]store.Pixel, 0, end-start)
+			for _, mismatch := range mismatches[start:end] {
+				batch = append(batch, store.Pixel{X: uint16(mismatch.X), Y: uint16(mismatch.Y), Col: mismatch.Cassandra, User: mismatch.User})
+			}
+
+			// published like any other write so connected clients repaint the pixels
+			_, err := boardStore.SetPixels(ctx, batch, metadata)
+			if err != nil {
+				return repaired, err
+			}
+			repaired += len(batch)
+		}
+
+		return repaired, nil
+
+	case DIRECTION_TO_CASSANDRA:
+		ts := time.Now()
+		for i, mismatch := range mismatches {
+			err := pixels.Upsert(ctx, store.Pixel{X: uint16(mismatch.X), Y: uint16(mismatch.Y), Col: mismatch.Redis, User: REPAIR_USER}, 0, ts)
+			if err != nil {
+				return i, err
+			}
+		}
+
+		return len(mismatches), nil
+	}
+
+	return 0, ErrInvalidDirection
+}
@@ -0,0 +1,156 @@
+package consistency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Common/board"
+	"Common/store"
+)
+
+var testMetadata = board.Metadata{Width: 250, Height: 150, BitsPerPixel: 4}
+
+// setup returns stores that agree on every pixel but the drifted ones
+func setup(t *testing.T) (*store.MemoryBoardStore, *store.MemoryPixelRepository) {
+	ctx := context.Background()
+	boardStore := store.NewMemoryBoardStore()
+	boardStore.WriteBoard(ctx, make([]uint8, testMetadata.BitfieldSize()), testMetadata)
+	repository := store.NewMemoryPixelRepository()
+
+	agreed := []store.Pixel{{X: 0, Y: 0, Col: 3, User: "alice"}, {X: 249, Y: 149, Col: 15, User: "alice"}}
+	boardStore.SetPixels(ctx, agreed, testMetadata)
+	for _, pixel := range agreed {
+		repository.Upsert(ctx, pixel, 0, time.Now())
+	}
+
+	// drifted: the keyspace write of a pixel failed, then a later one did
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 10, Y: 10, Col: 7}, {X: 120, Y: 20, Col: 4}, {X: 130, Y: 20, Col: 4}}, testMetadata)
+	repository.Upsert(ctx, store.Pixel{X: 10, Y: 10, Col: 2, User: "bob"}, 0, time.Now())
+	// written to the keyspace only
+	repository.Upsert(ctx, store.Pixel{X: 5, Y: 140, Col: 9, User: "carol"}, 0, time.Now())
+
+	// skipped
+	repository.Upsert(ctx, store.Pixel{X: 300, Y: 0, Col: 1, User: "dave"}, 0, time.Now())
+	repository.Upsert(ctx, store.Pixel{X: 1, Y: 1, Col: 16, User: "dave"}, 0, time.Now())
+	repository.BadRows = 1
+
+	return boardStore, repository
+}
+
+func TestCheck(t *testing.T) {
+	boardStore, repository := setup(t)
+
+	report, mismatches, err := Check(context.Background(), boardStore, repository, Options{ChunkSize: 100, Samples: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.RowsRead != 7 || report.RowsSkipped != 3 {
+		t.Fatalf("expected 7 rows read and 3 skipped, got %d and %d", report.RowsRead, report.RowsSkipped)
+	}
+	if report.Mismatches != 4 || report.Missing != 2 || len(mismatches) != 4 {
+		t.Fatalf("expected 4 mismatches with 2 missing rows, got %d with %d (%d returned)", report.Mismatches, report.Missing, len(mismatches))
+	}
+
+	expected := []Mismatch{
+		{X: 10, Y: 10, Redis: 7, Cassandra: 2, User: "bob"},
+		{X: 120, Y: 20, Redis: 4, Missing: true},
+		{X: 130, Y: 20, Redis: 4, Missing: true},
+		{X: 5, Y: 140, Redis: 0, Cassandra: 9, User: "carol"},
+	}
+	for i, mismatch := range expected {
+		if mismatches[i] != mismatch {
+			t.Fatalf("expected mismatch %d to be %+v, got %+v", i, mismatch, mismatches[i])
+		}
+	}
+	if len(report.Samples) != 2 || report.Samples[0] != expected[0] || report.Samples[1] != expected[1] {
+		t.Fatalf("expected the first 2 mismatches as samples, got %+v", report.Samples)
+	}
+
+	chunks := []Chunk{{X: 100, Y: 0, Mismatches: 2}, {X: 0, Y: 0, Mismatches: 1}, {X: 0, Y: 100, Mismatches: 1}}
+	if len(report.Chunks) != len(chunks) {
+		t.Fatalf("expected chunks %+v, got %+v", chunks, report.Chunks)
+	}
+	for i, chunk := range chunks {
+		if report.Chunks[i] != chunk {
+			t.Fatalf("expected chunks %+v, got %+v", chunks, report.Chunks)
+		}
+	}
+}
+
+func TestCheckIgnoresPixelsWrittenDuringTheScan(t *testing.T) {
+	ctx := context.Background()
+	boardStore, repository := setup(t)
+
+	// the board snapshot misses a pixel written to both stores while the table is scanned
+	racing := store.Pixel{X: 50, Y: 50, Col: 6, User: "erin"}
+	repository.Upsert(ctx, racing, 0, time.Now())
+	scanning := &racingRepository{MemoryPixelRepository: repository, write: func() {
+		boardStore.SetPixels(ctx, []store.Pixel{racing}, testMetadata)
+	}}
+
+	report, _, err := Check(ctx, boardStore, scanning, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Mismatches != 4 {
+		t.Fatalf("expected the pixel written during the scan to be ignored, got %d mismatches", report.Mismatches)
+	}
+}
+
+// racingRepository runs write once its scan has started
+type racingRepository struct {
+	*store.MemoryPixelRepository
+	write func()
+}
+
+func (repository *racingRepository) Scan(ctx context.Context, fn func(store.Pixel, error) error) error {
+	repository.write()
+	return repository.MemoryPixelRepository.Scan(ctx, fn)
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		direction string
+		colors    map[[2]int]uint8 // agreed on by both stores after the repair
+	}{
+		{DIRECTION_TO_REDIS, map[[2]int]uint8{{10, 10}: 2, {120, 20}: 0, {130, 20}: 0, {5, 140}: 9}},
+		{DIRECTION_TO_CASSANDRA, map[[2]int]uint8{{10, 10}: 7, {120, 20}: 4, {130, 20}: 4, {5, 140}: 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.direction, func(t *testing.T) {
+			ctx := context.Background()
+			boardStore, repository := setup(t)
+
+			report, mismatches, err := Check(ctx, boardStore, repository, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repaired, err := Repair(ctx, boardStore, repository, report.Metadata, mismatches, test.direction)
+			if err != nil || repaired != 4 {
+				t.Fatalf("expected 4 pixels to be repaired, got %d (%v)", repaired, err)
+			}
+
+			for position, col := range test.colors {
+				inBoard, _ := boardStore.GetPixel(ctx, position[0], position[1])
+				inRepository, _ := repository.Read(ctx, uint16(position[0]), uint16(position[1]))
+				if inBoard != col || inRepository.Col != col {
+					t.Fatalf("expected color %d at %v, got %d in the board and %d in the repository", col, position, inBoard, inRepository.Col)
+				}
+			}
+
+			report, _, err = Check(ctx, boardStore, repository, Options{})
+			if err != nil || report.Mismatches != 0 {
+				t.Fatalf("expected the stores to agree after the repair, got %d mismatches (%v)", report.Mismatches, err)
+			}
+		})
+	}
+
+	_, err := Repair(context.Background(), store.NewMemoryBoardStore(), store.NewMemoryPixelRepository(), testMetadata, nil, "sideways")
+	if err != ErrInvalidDirection {
+		t.Fatalf("expected an invalid direction to be rejected, got %v", err)
+	}
+}
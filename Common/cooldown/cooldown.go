@@ -0,0 +1,187 @@
+// Package cooldown keeps the policy deciding how long users wait between two pixels in redis, so
+// admins can change it without redeploying the lambdas.
+package cooldown
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// hash of "default" and tier names to cooldowns in seconds
+const REDIS_COOLDOWN_POLICY_KEY = "CooldownPolicy"
+
+// prefix of the key holding the tier of a user, the key of a new account expires with NEW_ACCOUNT_PERIOD
+const REDIS_USER_TIER_KEY_PREFIX = "UserTier:"
+
+// prefix of the key holding the unix time of the last pixel of a user, the prefix keeps user names
+// from colliding with the other keys
+const REDIS_COOLDOWN_KEY_PREFIX = "Cooldown:"
+
+// used while no default is stored in the policy
+const DEFAULT_COOLDOWN = 5 * time.Minute
+
+// longest cooldown a policy may set, the cooldown key of a user lives this long so raising the
+// cooldown also holds back users that are already waiting
+const MAX_COOLDOWN = 24 * time.Hour
+
+// how long a freshly registered account stays in TIER_NEW
+const NEW_ACCOUNT_PERIOD = 24 * time.Hour
+
+const POLICY_DEFAULT_FIELD = "default"
+
+const (
+	TIER_TRUSTED   = "trusted"
+	TIER_MODERATOR = "moderator"
+	TIER_NEW       = "new"
+)
+
+var TIERS = []string{TIER_TRUSTED, TIER_MODERATOR, TIER_NEW}
+
+// Policy is the cooldown of users without a tier and the overrides of the tiers, in seconds
+type Policy struct {
+	Default int64            `json:"default"`
+	Tiers   map[string]int64 `json:"tiers"`
+}
+
+func IsTier(tier string) bool {
+	for _, known := range TIERS {
+		if tier == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (policy *Policy) Validate() error {
+	maxSeconds := int64(MAX_COOLDOWN / time.Second)
+	if policy.Default <= 0 || policy.Default > maxSeconds {
+		return fmt.Errorf("default cooldown must be positive and at most %d seconds", maxSeconds)
+	}
+
+	for tier, seconds := range policy.Tiers {
+		if !IsTier(tier) || seconds < 0 || seconds > maxSeconds {
+			return fmt.Errorf("invalid cooldown %d for tier %q", seconds, tier)
+		}
+	}
+
+	return nil
+}
+
+// Cooldown returns how long a user of the tier waits, tier is empty for users without one
+func (policy *Policy) Cooldown(tier string) time.Duration {
+	if seconds, ok := policy.Tiers[tier]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return time.Duration(policy.Default) * time.Second
+}
+
+func Redis_GetPolicy(ctx context.Context, client *redis.Client) (Policy, error) {
+	fields, err := client.HGetAll(ctx, REDIS_COOLDOWN_POLICY_KEY).Result()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	policy := Policy{Default: int64(DEFAULT_COOLDOWN / time.Second), Tiers: make(map[string]int64)}
+	for field, value := range fields {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid cooldown %q for %q", value, field)
+		}
+
+		if field == POLICY_DEFAULT_FIELD {
+			policy.Default = seconds
+		} else {
+			policy.Tiers[field] = seconds
+		}
+	}
+
+	return policy, nil
+}
+
+// Redis_SetPolicy replaces the stored policy
+func Redis_SetPolicy(ctx context.Context, client *redis.Client, policy Policy) error {
+	values := []interface{}{POLICY_DEFAULT_FIELD, policy.Default}
+	for tier, seconds := range policy.Tiers {
+		values = append(values, tier, seconds)
+	}
+
+	tx := client.TxPipeline()
+	tx.Del(ctx, REDIS_COOLDOWN_POLICY_KEY)
+	tx.HSet(ctx, REDIS_COOLDOWN_POLICY_KEY, values...)
+	_, err := tx.Exec(ctx)
+
+	return err
+}
+
+// Redis_GetTier returns the tier of the user, empty if the user has none
+func Redis_GetTier(ctx context.Context, client *redis.Client, user string) (string, error) {
+	tier, err := client.Get(ctx, REDIS_USER_TIER_KEY_PREFIX+user).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return tier, err
+}
+
+// Redis_SetTier moves the user to a tier for the given duration, 0 for good, an empty tier
+// removes the user from its tier
+func Redis_SetTier(ctx context.Context, client *redis.Client, user string, tier string, duration time.Duration) error {
+	if tier == "" {
+		return client.Del(ctx, REDIS_USER_TIER_KEY_PREFIX+user).Err()
+	}
+
+	return client.Set(ctx, REDIS_USER_TIER_KEY_PREFIX+user, tier, duration).Err()
+}
+
+// Redis_GetCooldown returns how long the user currently waits between two pixels
+func Redis_GetCooldown(ctx context.Context, client *redis.Client, user string) (time.Duration, error) {
+	policy, err := Redis_GetPolicy(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+
+	tier, err := Redis_GetTier(ctx, client, user)
+	if err != nil {
+		return 0, err
+	}
+
+	return policy.Cooldown(tier), nil
+}
+
+// Redis_GetRemaining returns how long the user still has to wait before placing a pixel and the
+// time of the redis server it was measured against, see REDIS_COOLDOWN_KEY_PREFIX
+func Redis_GetRemaining(ctx context.Context, client *redis.Client, user string) (time.Duration, time.Time, error) {
+	cooldown, err := Redis_GetCooldown(ctx, client, user)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	tx := client.TxPipeline()
+	last := tx.Get(ctx, REDIS_COOLDOWN_KEY_PREFIX+user)
+	now := tx.Time(ctx)
+	_, err = tx.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return 0, time.Time{}, err
+	}
+	if err == redis.Nil {
+		return 0, now.Val(), nil
+	}
+
+	placedAt, err := last.Int64()
+	if err != nil {
+		return 0, now.Val(), err
+	}
+
+	remaining := time.Unix(placedAt, 0).Add(cooldown).Sub(now.Val())
+	if remaining < 0 {
+		return 0, now.Val(), nil
+	}
+
+	return remaining, now.Val(), nil
+}
@@ -0,0 +1,21 @@
+module Common
+
+go 1.19
+
+require (
+	github.com/alicebob/miniredis/v2 v2.30.0
+	github.com/aws/aws-sdk-go v1.44.150
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/gocql/gocql v1.3.0
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64 // indirect
+	gopkg.in/inf.v0 v0.9.1 // indirect
+)
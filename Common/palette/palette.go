@@ -0,0 +1,62 @@
+// Package palette holds the colors pixels can be painted with. Every component, and the client
+// through /api/palette, takes them from here, so adding or changing a color only touches PALETTE.
+package palette
+
+import (
+	"fmt"
+	"image/color"
+
+	"Common/boardimage"
+)
+
+// Color is a named "#rrggbb" color, pixels store its index in PALETTE
+type Color struct {
+	Name string `json:"name"`
+	Hex  string `json:"hex"`
+}
+
+// PALETTE is ordered by color index, colors must only be appended so painted pixels keep their
+// color. It can't have more colors than the bits per pixel of the board can address.
+var PALETTE = []Color{
+	{Name: "white", Hex: "#ffffff"},
+	{Name: "black", Hex: "#000000"},
+	{Name: "blue", Hex: "#2450a4"},
+	{Name: "green", Hex: "#00a368"},
+	{Name: "red", Hex: "#be0039"},
+	{Name: "orange", Hex: "#ffa800"},
+	{Name: "yellow", Hex: "#ffff00"},
+	{Name: "brown", Hex: "#6d482f"},
+	{Name: "purple", Hex: "#811e9f"},
+	{Name: "pink", Hex: "#b44ac0"},
+	{Name: "lightgreen", Hex: "#7eed56"},
+	{Name: "lightblue", Hex: "#3690ea"},
+	{Name: "lightred", Hex: "#be0049"},
+	{Name: "lightyellow", Hex: "#ffd631"},
+	{Name: "maroon", Hex: "#6d001a"},
+	{Name: "violet", Hex: "#e4abff"},
+}
+
+// IsColor reports whether index is a color of the palette
+func IsColor(index int) bool {
+	return index >= 0 && index < len(PALETTE)
+}
+
+// Hex returns the hex values of the palette, ordered by color index
+func Hex() []string {
+	colors := make([]string, len(PALETTE))
+	for i, c := range PALETTE {
+		colors[i] = c.Hex
+	}
+
+	return colors
+}
+
+// Image returns the palette for rendering the board
+func Image() (color.Palette, error) {
+	palette, err := boardimage.PaletteFromHex(Hex())
+	if err != nil {
+		return nil, fmt.Errorf("invalid palette - %w", err)
+	}
+
+	return palette, nil
+}
@@ -0,0 +1,94 @@
+// Package session issues and verifies the signed tokens users authenticate with. A token is the
+// base64 encoded json Claims followed by a dot and the base64 encoded HMAC-SHA256 of that part.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// how long a token issued at login stays valid
+const SESSION_TOKEN_LIFETIME = 7 * 24 * time.Hour
+
+// the ALB lower-cases header names before invoking the lambdas
+const AUTHORIZATION_HEADER = "authorization"
+
+var ErrInvalidToken = errors.New("invalid session token")
+var ErrExpiredToken = errors.New("expired session token")
+
+type Claims struct {
+	User      string `json:"user"`
+	ExpiresAt int64  `json:"exp"` // unix seconds
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken returns a token for user that expires after lifetime
+func IssueToken(secret []byte, user string, lifetime time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(lifetime).Truncate(time.Second)
+	serialized, err := json.Marshal(Claims{User: user, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(serialized)
+	return payload + "." + sign(secret, payload), expiresAt, nil
+}
+
+// VerifyToken checks the signature and expiry of a token and returns the user it was issued to
+func VerifyToken(secret []byte, token string) (string, error) {
+	if len(secret) == 0 {
+		return "", ErrInvalidToken
+	}
+
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(secret, payload))) {
+		return "", ErrInvalidToken
+	}
+
+	serialized, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	var claims Claims
+	err = json.Unmarshal(serialized, &claims)
+	if err != nil || claims.User == "" {
+		return "", ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", ErrExpiredToken
+	}
+
+	return claims.User, nil
+}
+
+// GetBearerToken extracts the token from an "Authorization: Bearer <token>" header value
+func GetBearerToken(authorization string) string {
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// VerifyHeaders returns the user of the bearer token in the lower-cased request headers
+func VerifyHeaders(secret []byte, headers map[string]string) (string, error) {
+	token := GetBearerToken(headers[AUTHORIZATION_HEADER])
+	if token == "" {
+		return "", ErrInvalidToken
+	}
+
+	return VerifyToken(secret, token)
+}
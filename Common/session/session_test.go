@@ -0,0 +1,90 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret")
+
+func TestIssuedTokensVerify(t *testing.T) {
+	token, expiresAt, err := IssueToken(testSecret, "alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt.Before(time.Now().Add(59*time.Minute)) || expiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expected the token to expire in an hour, got %v", expiresAt)
+	}
+
+	user, err := VerifyToken(testSecret, token)
+	if err != nil || user != "alice" {
+		t.Fatalf("expected the token of alice, got %q (%v)", user, err)
+	}
+
+	user, err = VerifyHeaders(testSecret, map[string]string{AUTHORIZATION_HEADER: "Bearer " + token})
+	if err != nil || user != "alice" {
+		t.Fatalf("expected the header of alice, got %q (%v)", user, err)
+	}
+}
+
+func TestVerifyTokenRejectsInvalidTokens(t *testing.T) {
+	token, _, _ := IssueToken(testSecret, "alice", time.Hour)
+	expired, _, _ := IssueToken(testSecret, "alice", -time.Second)
+	noUser, _, _ := IssueToken(testSecret, "", time.Hour)
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, _, _ := IssueToken([]byte("other secret"), "mallory", time.Hour)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		err    error
+	}{
+		{"expired", testSecret, expired, ErrExpiredToken},
+		{"other secret", []byte("other secret"), token, ErrInvalidToken},
+		{"no secret", nil, token, ErrInvalidToken},
+		{"payload of another token", testSecret, forgedPayload + "." + signature, ErrInvalidToken},
+		{"no signature", testSecret, payload, ErrInvalidToken},
+		{"no user", testSecret, noUser, ErrInvalidToken},
+		{"not base64", testSecret, "!!!." + sign(testSecret, "!!!"), ErrInvalidToken},
+		{"not json", testSecret, "bm90IGpzb24." + sign(testSecret, "bm90IGpzb24"), ErrInvalidToken},
+		{"empty", testSecret, "", ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := VerifyToken(test.secret, test.token)
+			if err != test.err || user != "" {
+				t.Fatalf("expected %v, got %q (%v)", test.err, user, err)
+			}
+		})
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	tests := []struct {
+		authorization string
+		token         string
+	}{
+		{"Bearer abc.def", "abc.def"},
+		{"bearer abc.def", "abc.def"},
+		{"Bearer  abc.def ", "abc.def"},
+		{"Basic abc.def", ""},
+		{"abc.def", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		token := GetBearerToken(test.authorization)
+		if token != test.token {
+			t.Fatalf("expected %q from %q, got %q", test.token, test.authorization, token)
+		}
+	}
+
+	_, err := VerifyHeaders(testSecret, map[string]string{})
+	if err != ErrInvalidToken {
+		t.Fatalf("expected requests without a token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore keeps the snapshots, FileBlobStore on a dev machine and S3BlobStore in prod
+type BlobStore interface {
+	Put(ctx context.Context, name string, data []byte) error
+
+	// Get returns the content of a blob, ErrBlobNotFound if there is none with that name
+	Get(ctx context.Context, name string) ([]byte, error)
+
+	// List returns every blob, in no particular order
+	List(ctx context.Context) ([]BlobInfo, error)
+
+	Delete(ctx context.Context, name string) error
+}
+
+// NewBlobStoreFromEnv returns the S3BlobStore of SNAPSHOT_BUCKET under SNAPSHOT_PREFIX if it is
+// set, else the FileBlobStore of SNAPSHOT_DIR, and nil if neither is set
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	bucket := os.Getenv("SNAPSHOT_BUCKET")
+	if bucket != "" {
+		awsSession, err := session.NewSession()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create an aws session - %w", err)
+		}
+
+		return NewS3BlobStore(s3.New(awsSession), bucket, os.Getenv("SNAPSHOT_PREFIX")), nil
+	}
+
+	dir := os.Getenv("SNAPSHOT_DIR")
+	if dir != "" {
+		return NewFileBlobStore(dir)
+	}
+
+	return nil, nil
+}
+
+var _ BlobStore = (*FileBlobStore)(nil)
+var _ BlobStore = (*S3BlobStore)(nil)
+
+// FileBlobStore keeps every blob in a file of Dir
+type FileBlobStore struct {
+	Dir string
+}
+
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{Dir: dir}, nil
+}
+
+func (store *FileBlobStore) path(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid blob name %q", name)
+	}
+
+	return filepath.Join(store.Dir, name), nil
+}
+
+// Put writes the blob to a temporary file renamed over the blob, so a crash never leaves half of it
+func (store *FileBlobStore) Put(ctx context.Context, name string, data []byte) error {
+	path, err := store.path(name)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(store.Dir, ".tmp-"+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func (store *FileBlobStore) Get(ctx context.Context, name string) ([]byte, error) {
+	path, err := store.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+
+	return data, err
+}
+
+func (store *FileBlobStore) List(ctx context.Context) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(store.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := []BlobInfo{}
+	for _, entry := range entries {
+		// temporary files of Put
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, BlobInfo{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+
+	return blobs, nil
+}
+
+func (store *FileBlobStore) Delete(ctx context.Context, name string) error {
+	path, err := store.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+
+	return err
+}
+
+// S3BlobStore keeps every blob in an object of Bucket whose key is Prefix followed by its name
+type S3BlobStore struct {
+	Client s3iface.S3API
+	Bucket string
+	Prefix string
+}
+
+func NewS3BlobStore(client s3iface.S3API, bucket string, prefix string) *S3BlobStore {
+	return &S3BlobStore{Client: client, Bucket: bucket, Prefix: prefix}
+}
+
+func (store *S3BlobStore) Put(ctx context.Context, name string, data []byte) error {
+	_, err := store.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    aws.String(store.Prefix + name),
+		Body:   bytes.NewReader(data),
+	})
+
+	return err
+}
+
+func (store *S3BlobStore) Get(ctx context.Context, name string) ([]byte, error) {
+	output, err := store.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    aws.String(store.Prefix + name),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+func (store *S3BlobStore) List(ctx context.Context) ([]BlobInfo, error) {
+	blobs := []BlobInfo{}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(store.Bucket), Prefix: aws.String(store.Prefix)}
+	err := store.Client.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			blobs = append(blobs, BlobInfo{
+				Name:    strings.TrimPrefix(aws.StringValue(object.Key), store.Prefix),
+				Size:    aws.Int64Value(object.Size),
+				ModTime: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+
+	return blobs, err
+}
+
+func (store *S3BlobStore) Delete(ctx context.Context, name string) error {
+	_, err := store.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    aws.String(store.Prefix + name),
+	})
+
+	return err
+}
@@ -0,0 +1,281 @@
+// Package snapshot saves compressed copies of the board to a BlobStore so a redis that lost the
+// board can be restored without scanning Cassandra with InitializeRedis.
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Common/board"
+	"Common/store"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// snapshots are named board-<time>-v<version>.gz so their names sort by time, see GetSnapshotName
+const SNAPSHOT_NAME_PREFIX = "board-"
+const SNAPSHOT_NAME_SUFFIX = ".gz"
+const SNAPSHOT_TIME_FORMAT = "20060102T150405Z"
+
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Info describes a snapshot, it is stored as the comment of its gzip header
+type Info struct {
+	Name      string          `json:"name"`
+	Version   uint64          `json:"version"` // board version, the sequence number of the last pixel in it
+	Timestamp time.Time       `json:"timestamp"`
+	Size      int64           `json:"size"`               // compressed, in bytes
+	Metadata  *board.Metadata `json:"metadata,omitempty"` // only known once the snapshot is read
+}
+
+type Snapshot struct {
+	Info
+	Bitfield []uint8
+}
+
+// Retention decides which snapshots Prune deletes, the newest snapshot is always kept
+type Retention struct {
+	Keep   int           // snapshots kept, every one when 0
+	MaxAge time.Duration // age after which a snapshot is deleted, never when 0
+}
+
+// GetSnapshotName returns the name of the snapshot of version taken at ts
+func GetSnapshotName(version uint64, ts time.Time) string {
+	return fmt.Sprintf("%s%s-v%020d%s", SNAPSHOT_NAME_PREFIX, ts.UTC().Format(SNAPSHOT_TIME_FORMAT), version, SNAPSHOT_NAME_SUFFIX)
+}
+
+// ParseSnapshotName returns the version and the time in the name of a snapshot
+func ParseSnapshotName(name string) (uint64, time.Time, error) {
+	if !strings.HasPrefix(name, SNAPSHOT_NAME_PREFIX) || !strings.HasSuffix(name, SNAPSHOT_NAME_SUFFIX) {
+		return 0, time.Time{}, fmt.Errorf("%w name %q", ErrInvalidSnapshot, name)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, SNAPSHOT_NAME_PREFIX), SNAPSHOT_NAME_SUFFIX), "-v")
+	if len(parts) != 2 {
+		return 0, time.Time{}, fmt.Errorf("%w name %q", ErrInvalidSnapshot, name)
+	}
+
+	ts, err := time.Parse(SNAPSHOT_TIME_FORMAT, parts[0])
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("%w name %q", ErrInvalidSnapshot, name)
+	}
+
+	version, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("%w name %q", ErrInvalidSnapshot, name)
+	}
+
+	return version, ts, nil
+}
+
+// Redis_Capture reads the bitfield, the metadata and the version of the board in one transaction
+// so they always agree
+func Redis_Capture(ctx context.Context, client *redis.Client) (Snapshot, error) {
+	var bitfield *redis.StringCmd
+	var fields *redis.MapStringStringCmd
+	var version *redis.StringCmd
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		bitfield = pipe.Get(ctx, board.REDIS_BITFIELD_KEY)
+		fields = pipe.HGetAll(ctx, board.REDIS_BOARD_METADATA_KEY)
+		version = pipe.Get(ctx, store.REDIS_SEQUENCE_KEY)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return Snapshot{}, err
+	}
+
+	metadata, err := board.ParseMetadata(fields.Val())
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// redis drops the trailing bytes no pixel was written to
+	snapshot := Snapshot{Info: Info{Timestamp: time.Now().UTC(), Metadata: &metadata}}
+	snapshot.Bitfield = make([]uint8, metadata.BitfieldSize())
+	copy(snapshot.Bitfield, bitfield.Val())
+
+	if version.Val() != "" {
+		snapshot.Version, err = strconv.ParseUint(version.Val(), 10, 64)
+		if err != nil {
+			return Snapshot{}, err
+		}
+	}
+
+	snapshot.Name = GetSnapshotName(snapshot.Version, snapshot.Timestamp)
+	return snapshot, nil
+}
+
+// Encode compresses the bitfield, the rest of the snapshot goes in the gzip header
+func Encode(snapshot Snapshot) ([]byte, error) {
+	header, err := json.Marshal(snapshot.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	writer.Comment = string(header)
+	writer.ModTime = snapshot.Timestamp
+
+	_, err = writer.Write(snapshot.Bitfield)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	return buffer.Bytes(), err
+}
+
+// Decode reverses Encode and checks the bitfield fits the metadata
+func Decode(data []byte) (Snapshot, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%w - %s", ErrInvalidSnapshot, err.Error())
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal([]byte(reader.Comment), &snapshot.Info)
+	if err != nil || snapshot.Metadata == nil {
+		return Snapshot{}, fmt.Errorf("%w header", ErrInvalidSnapshot)
+	}
+
+	err = snapshot.Metadata.Validate()
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// a corrupt snapshot can't make us allocate more than the largest board
+	snapshot.Bitfield, err = io.ReadAll(io.LimitReader(reader, int64(snapshot.Metadata.BitfieldSize())+1))
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%w - %s", ErrInvalidSnapshot, err.Error())
+	}
+	if len(snapshot.Bitfield) != snapshot.Metadata.BitfieldSize() {
+		return Snapshot{}, fmt.Errorf("%w, expected %d bytes of pixels, got %d", ErrInvalidSnapshot, snapshot.Metadata.BitfieldSize(), len(snapshot.Bitfield))
+	}
+
+	snapshot.Size = int64(len(data))
+	return snapshot, nil
+}
+
+// Write encodes the snapshot into blobs under its name
+func Write(ctx context.Context, blobs BlobStore, snapshot *Snapshot) error {
+	data, err := Encode(*snapshot)
+	if err != nil {
+		return err
+	}
+
+	snapshot.Size = int64(len(data))
+	return blobs.Put(ctx, snapshot.Name, data)
+}
+
+// Read returns the snapshot of blobs named name
+func Read(ctx context.Context, blobs BlobStore, name string) (Snapshot, error) {
+	data, err := blobs.Get(ctx, name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot, err := Decode(data)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot.Name = name
+	return snapshot, nil
+}
+
+// List returns the snapshots of blobs, newest first. Blobs that are not named like snapshots are
+// left out.
+func List(ctx context.Context, blobs BlobStore) ([]Info, error) {
+	listed, err := blobs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Info{}
+	for _, blob := range listed {
+		version, ts, err := ParseSnapshotName(blob.Name)
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, Info{Name: blob.Name, Version: version, Timestamp: ts, Size: blob.Size})
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name > snapshots[j].Name
+	})
+
+	return snapshots, nil
+}
+
+// Prune deletes the snapshots retention does not keep at now and returns their names
+func Prune(ctx context.Context, blobs BlobStore, retention Retention, now time.Time) ([]string, error) {
+	snapshots, err := List(ctx, blobs)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []string{}
+	for i, snapshot := range snapshots {
+		if i == 0 {
+			continue
+		}
+
+		tooMany := retention.Keep > 0 && i >= retention.Keep
+		tooOld := retention.MaxAge > 0 && now.Sub(snapshot.Timestamp) > retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		err := blobs.Delete(ctx, snapshot.Name)
+		if err != nil && err != ErrBlobNotFound {
+			return deleted, err
+		}
+		deleted = append(deleted, snapshot.Name)
+	}
+
+	return deleted, nil
+}
+
+// moves the board version past the one of the snapshot. When only the board was lost WriteBoard
+// already moved it past every version clients saw, when the sequence was lost as well it starts
+// over below them, clients resuming from a later version are then told to resync and the
+// websocket server resyncs the connected ones once it sees the sequence go back
+//
+// KEYS: sequence
+// ARGV: version of the snapshot
+var g_restoreVersionScript = redis.NewScript(`
+local version = tonumber(redis.call("GET", KEYS[1]) or "0")
+if version <= tonumber(ARGV[1]) then
+	redis.call("SET", KEYS[1], tonumber(ARGV[1]) + 1)
+end
+
+return redis.status_reply("OK")
+`)
+
+// Redis_Restore replaces the board with the snapshot, see store.RedisBoardStore.WriteBoard
+func Redis_Restore(ctx context.Context, client *redis.Client, snapshot Snapshot) error {
+	if snapshot.Metadata == nil {
+		return fmt.Errorf("%w, it has no metadata", ErrInvalidSnapshot)
+	}
+
+	err := store.NewRedisBoardStore(client).WriteBoard(ctx, snapshot.Bitfield, *snapshot.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return g_restoreVersionScript.Run(ctx, client, []string{store.REDIS_SEQUENCE_KEY}, snapshot.Version).Err()
+}
@@ -0,0 +1,220 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Common/board"
+	"Common/boardimage"
+	"Common/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func setupRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client, server := setupRedis(t)
+	boardStore := store.NewRedisBoardStore(client)
+	blobs, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := board.Metadata{Width: 40, Height: 30, BitsPerPixel: 5}
+	boardStore.WriteBoard(ctx, make([]uint8, metadata.BitfieldSize()), metadata)
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 1, Y: 2, Col: 20}, {X: 39, Y: 29, Col: 7}}, metadata)
+
+	snapshot, err := Redis_Capture(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != 3 || *snapshot.Metadata != metadata || len(snapshot.Bitfield) != metadata.BitfieldSize() {
+		t.Fatalf("expected version 3 of a %+v board, got %d of %+v with %d bytes", metadata, snapshot.Version, *snapshot.Metadata, len(snapshot.Bitfield))
+	}
+
+	err = Write(ctx, blobs, &snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the board is lost and written to again before it is restored, without reaching the version of
+	// the snapshot
+	server.FlushAll()
+	boardStore.PlacePixel(ctx, store.PlaceRequest{X: 5, Y: 5, Col: 3, User: "alice"})
+
+	snapshots, err := List(ctx, blobs)
+	if err != nil || len(snapshots) != 1 || snapshots[0].Name != snapshot.Name || snapshots[0].Version != 3 || snapshots[0].Size != snapshot.Size {
+		t.Fatalf("expected the written snapshot to be listed, got %+v (%v)", snapshots, err)
+	}
+
+	read, err := Read(ctx, blobs, snapshots[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Redis_Restore(ctx, client, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bitfield, _, restored, err := boardStore.ReadBoard(ctx)
+	if err != nil || restored != metadata {
+		t.Fatalf("expected metadata %+v, got %+v (%v)", metadata, restored, err)
+	}
+	if boardimage.GetPixel(bitfield, 2*40+1, 5) != 20 || boardimage.GetPixel(bitfield, 29*40+39, 5) != 7 || boardimage.GetPixel(bitfield, 5*40+5, 5) != 0 {
+		t.Fatal("expected the pixels of the snapshot and only those")
+	}
+
+	// the version moves past every version clients may have seen and the replay log is dropped
+	version, _ := server.Get(store.REDIS_SEQUENCE_KEY)
+	if version != "4" || server.Exists(store.REDIS_UPDATE_LOG_KEY) {
+		t.Fatalf("expected version 4 and no update log, got %s", version)
+	}
+}
+
+func TestDecodeRejectsCorruptSnapshots(t *testing.T) {
+	metadata := board.Metadata{Width: 4, Height: 4, BitsPerPixel: 4}
+	valid := Snapshot{Info: Info{Version: 1, Metadata: &metadata}, Bitfield: make([]uint8, 8)}
+
+	short := valid
+	short.Bitfield = make([]uint8, 7)
+	long := valid
+	long.Bitfield = make([]uint8, 9)
+	noMetadata := valid
+	noMetadata.Metadata = nil
+
+	for name, snapshot := range map[string]Snapshot{"short": short, "long": long, "no metadata": noMetadata} {
+		data, err := Encode(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = Decode(data)
+		if err == nil {
+			t.Fatalf("expected the %s snapshot to be rejected", name)
+		}
+	}
+
+	_, err := Decode([]byte("not gzip"))
+	if err == nil {
+		t.Fatal("expected a blob that is not gzip to be rejected")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		retention Retention
+		kept      []uint64 // versions
+	}{
+		{"keep everything", Retention{}, []uint64{6, 5, 4, 3, 2, 1}},
+		{"keep 3", Retention{Keep: 3}, []uint64{6, 5, 4}},
+		{"younger than 2h", Retention{MaxAge: 2 * time.Hour}, []uint64{6, 5}},
+		{"keep 2 younger than 3h", Retention{Keep: 2, MaxAge: 3 * time.Hour}, []uint64{6, 5}},
+		{"keep 4 younger than 3h", Retention{Keep: 4, MaxAge: 3 * time.Hour}, []uint64{6, 5, 4}},
+		{"newest is always kept", Retention{Keep: 1, MaxAge: time.Minute}, []uint64{6}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			blobs, err := NewFileBlobStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// one snapshot an hour, the newest one 30 minutes ago
+			for version := uint64(1); version <= 6; version++ {
+				ts := now.Add(-time.Duration(6-version)*time.Hour - 30*time.Minute)
+				blobs.Put(ctx, GetSnapshotName(version, ts), []byte{})
+			}
+			blobs.Put(ctx, "notes.txt", []byte{})
+
+			_, err = Prune(ctx, blobs, test.retention, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			snapshots, _ := List(ctx, blobs)
+			if len(snapshots) != len(test.kept) {
+				t.Fatalf("expected versions %v to be kept, got %+v", test.kept, snapshots)
+			}
+			for i, version := range test.kept {
+				if snapshots[i].Version != version {
+					t.Fatalf("expected versions %v to be kept, got %+v", test.kept, snapshots)
+				}
+			}
+
+			_, err = blobs.Get(ctx, "notes.txt")
+			if err != nil {
+				t.Fatal("expected blobs that are not snapshots to be left alone")
+			}
+		})
+	}
+}
+
+func TestFileBlobStoreRejectsPaths(t *testing.T) {
+	blobs, err := NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "../board.gz", "a/board.gz", ".tmp-board.gz"} {
+		err := blobs.Put(context.Background(), name, []byte{})
+		if err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+
+	_, err = blobs.Get(context.Background(), "missing.gz")
+	if err != ErrBlobNotFound {
+		t.Fatalf("expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func TestRestoreIntoAnEmptyRedis(t *testing.T) {
+	ctx := context.Background()
+	client, server := setupRedis(t)
+	boardStore := store.NewRedisBoardStore(client)
+
+	metadata := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 4}
+	boardStore.WriteBoard(ctx, make([]uint8, metadata.BitfieldSize()), metadata)
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 3, Y: 4, Col: 9}}, metadata)
+	snapshot, err := Redis_Capture(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clients saw later versions before redis lost everything, the sequence along with the board
+	for i := 0; i < 5; i++ {
+		boardStore.PlacePixel(ctx, store.PlaceRequest{X: uint16(i), Y: 0, Col: 2, User: "alice"})
+	}
+	server.FlushAll()
+
+	err = Redis_Restore(ctx, client, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the version starts over right after the snapshot, below the ones clients saw, they resync
+	// when the websocket server sees the sequence go back or when they resume from a later version
+	bitfield, version, restored, err := boardStore.ReadBoard(ctx)
+	if err != nil || version != snapshot.Version+1 || restored != metadata {
+		t.Fatalf("expected version %d of a %+v board, got %d of %+v (%v)", snapshot.Version+1, metadata, version, restored, err)
+	}
+	if boardimage.GetPixel(bitfield, 4*20+3, 4) != 9 || boardimage.GetPixel(bitfield, 0, 4) != 0 {
+		t.Fatal("expected the pixels of the snapshot and only those")
+	}
+}
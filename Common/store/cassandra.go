@@ -0,0 +1,302 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"Common/bans"
+
+	"github.com/gocql/gocql"
+)
+
+// CassandraTables names the tables of the keyspace the repository works on
+type CassandraTables struct {
+	Pixels     string // latest write of every pixel, rplace
+	Placements string // every write partitioned by the hour it was made in, see GetPlacementBucket
+	History    string // every write partitioned by pixel
+	Bans       string
+	Users      string // accounts of the Auth lambda
+}
+
+// placements are partitioned by the hour they were made in, see GetPlacementBucket
+const PLACEMENT_BUCKET_SIZE = time.Hour
+
+// rows fetched at a time by Scan and ScanBans
+const CASSANDRA_SCAN_PAGE_SIZE = 5000
+
+var _ PixelRepository = (*CassandraPixelRepository)(nil)
+
+// CassandraPixelRepository keeps pixels in the tables of notes.md, a nil Session makes every call
+// fail with ErrNotConnected
+type CassandraPixelRepository struct {
+	Session  *gocql.Session
+	Keyspace string
+	Tables   CassandraTables
+	PageSize int // CASSANDRA_SCAN_PAGE_SIZE when 0
+}
+
+func NewCassandraPixelRepository(session *gocql.Session, keyspace string, tables CassandraTables) *CassandraPixelRepository {
+	return &CassandraPixelRepository{Session: session, Keyspace: keyspace, Tables: tables}
+}
+
+// GetPlacementBucket returns the partition of the placements table a write made at ts belongs to
+func GetPlacementBucket(ts time.Time) int64 {
+	return ts.Unix() / int64(PLACEMENT_BUCKET_SIZE/time.Second)
+}
+
+func (repository *CassandraPixelRepository) table(name string) string {
+	return fmt.Sprintf("%s.%s", repository.Keyspace, name)
+}
+
+// Upsert writes to every table even when one of them fails, the first error is returned
+func (repository *CassandraPixelRepository) Upsert(ctx context.Context, pixel Pixel, seq uint64, ts time.Time) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	var firstErr error
+	query_string := fmt.Sprintf("UPDATE %s SET col=?, user=? WHERE pixel_x=? AND pixel_y=?", repository.table(repository.Tables.Pixels))
+	err := repository.Session.Query(query_string, pixel.Col, pixel.User, pixel.X, pixel.Y).WithContext(ctx).Exec()
+	if err != nil {
+		firstErr = fmt.Errorf("error in adding to the table - %w", err)
+	}
+
+	// the rplace table only keeps the latest write of every pixel, every placement is also
+	// appended to the placements table in time order so the board can be replayed
+	query_string = fmt.Sprintf("INSERT INTO %s (bucket, ts, seq, pixel_x, pixel_y, col, user) VALUES (?, ?, ?, ?, ?, ?, ?)", repository.table(repository.Tables.Placements))
+	err = repository.Session.Query(query_string, GetPlacementBucket(ts), ts, int64(seq), pixel.X, pixel.Y, pixel.Col, pixel.User).WithContext(ctx).Exec()
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error in adding to the placements table - %w", err)
+	}
+
+	// and to the history of the pixel so moderators can see who painted it before
+	query_string = fmt.Sprintf("INSERT INTO %s (pixel_x, pixel_y, ts, seq, col, user) VALUES (?, ?, ?, ?, ?, ?)", repository.table(repository.Tables.History))
+	err = repository.Session.Query(query_string, pixel.X, pixel.Y, ts, int64(seq), pixel.Col, pixel.User).WithContext(ctx).Exec()
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("error in adding to the pixel history table - %w", err)
+	}
+
+	return firstErr
+}
+
+func (repository *CassandraPixelRepository) Read(ctx context.Context, x uint16, y uint16) (Pixel, error) {
+	if repository.Session == nil {
+		return Pixel{}, ErrNotConnected
+	}
+
+	var pixel Pixel
+	query_string := fmt.Sprintf("SELECT pixel_x, pixel_y, col, user FROM %s WHERE pixel_x=? AND pixel_y=?", repository.table(repository.Tables.Pixels))
+	err := repository.Session.Query(query_string, x, y).WithContext(ctx).Scan(&pixel.X, &pixel.Y, &pixel.Col, &pixel.User)
+	if err == gocql.ErrNotFound {
+		return Pixel{}, ErrNotFound
+	}
+
+	return pixel, err
+}
+
+func (repository *CassandraPixelRepository) History(ctx context.Context, x uint16, y uint16, limit int) ([]Placement, error) {
+	if repository.Session == nil {
+		return nil, ErrNotConnected
+	}
+
+	query_string := fmt.Sprintf("SELECT ts, col, user FROM %s WHERE pixel_x=? AND pixel_y=? LIMIT ?", repository.table(repository.Tables.History))
+	iter := repository.Session.Query(query_string, x, y, limit).WithContext(ctx).Iter()
+
+	history := []Placement{}
+	var placement Placement
+	for iter.Scan(&placement.Timestamp, &placement.Col, &placement.User) {
+		history = append(history, placement)
+	}
+
+	return history, iter.Close()
+}
+
+// ReadAt reads the history of the pixel, which is clustered by time, newest first
+func (repository *CassandraPixelRepository) ReadAt(ctx context.Context, x uint16, y uint16, ts time.Time) (Placement, error) {
+	if repository.Session == nil {
+		return Placement{}, ErrNotConnected
+	}
+
+	var placement Placement
+	query_string := fmt.Sprintf("SELECT ts, col, user FROM %s WHERE pixel_x=? AND pixel_y=? AND ts<=? LIMIT 1", repository.table(repository.Tables.History))
+	err := repository.Session.Query(query_string, x, y, ts).WithContext(ctx).Scan(&placement.Timestamp, &placement.Col, &placement.User)
+	if err == gocql.ErrNotFound {
+		return Placement{}, ErrNotFound
+	}
+
+	return placement, err
+}
+
+// scanPages runs a query one page at a time so a scan of the whole table never holds more than a
+// page, scan is called for every row and rows that fail to scan are passed to it as a ScanError
+func (repository *CassandraPixelRepository) scanPages(ctx context.Context, query_string string, dest []interface{}, scan func(err error) error) error {
+	pageSize := repository.PageSize
+	if pageSize <= 0 {
+		pageSize = CASSANDRA_SCAN_PAGE_SIZE
+	}
+
+	var pageState []byte
+	for {
+		iter := repository.Session.Query(query_string).WithContext(ctx).PageSize(pageSize).PageState(pageState).Iter()
+		pageState = iter.PageState()
+
+		scanner := iter.Scanner()
+		for scanner.Next() {
+			err := scanner.Scan(dest...)
+			if err != nil {
+				err = &ScanError{Err: err}
+			}
+
+			err = scan(err)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		err := scanner.Err()
+		if err != nil {
+			return err
+		}
+
+		if len(pageState) == 0 {
+			return nil
+		}
+	}
+}
+
+func (repository *CassandraPixelRepository) Scan(ctx context.Context, fn func(Pixel, error) error) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	var pixel Pixel
+	query_string := fmt.Sprintf("SELECT pixel_x, pixel_y, col, user FROM %s", repository.table(repository.Tables.Pixels))
+	return repository.scanPages(ctx, query_string, []interface{}{&pixel.X, &pixel.Y, &pixel.Col, &pixel.User}, func(err error) error {
+		if err != nil {
+			return fn(Pixel{}, err)
+		}
+
+		return fn(pixel, nil)
+	})
+}
+
+func (repository *CassandraPixelRepository) ScanPlacements(ctx context.Context, from time.Time, to time.Time, fn func(pixel Pixel, seq uint64, ts time.Time) error) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	query_string := fmt.Sprintf("SELECT ts, seq, pixel_x, pixel_y, col, user FROM %s WHERE bucket=? AND ts>=? AND ts<?", repository.table(repository.Tables.Placements))
+	for bucket := GetPlacementBucket(from); bucket <= GetPlacementBucket(to); bucket++ {
+		iter := repository.Session.Query(query_string, bucket, from, to).WithContext(ctx).Iter()
+		scanner := iter.Scanner()
+		for scanner.Next() {
+			var pixel Pixel
+			var seq int64
+			var ts time.Time
+			err := scanner.Scan(&ts, &seq, &pixel.X, &pixel.Y, &pixel.Col, &pixel.User)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+
+			err = fn(pixel, uint64(seq), ts)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		err := scanner.Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repository *CassandraPixelRepository) ScanBans(ctx context.Context, fn func(bans.Ban) error) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	var ban bans.Ban
+	query_string := fmt.Sprintf("SELECT user, type, reason, created_at, expires_at FROM %s", repository.table(repository.Tables.Bans))
+	return repository.scanPages(ctx, query_string, []interface{}{&ban.User, &ban.Type, &ban.Reason, &ban.CreatedAt, &ban.ExpiresAt}, func(err error) error {
+		if err != nil {
+			return err
+		}
+
+		return fn(ban)
+	})
+}
+
+func (repository *CassandraPixelRepository) SaveBan(ctx context.Context, ban bans.Ban) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	// a permanent ban is written with a null expiry and read back as nil by ScanBans
+	query_string := fmt.Sprintf("INSERT INTO %s (user, type, reason, created_at, expires_at) VALUES (?, ?, ?, ?, ?)", repository.table(repository.Tables.Bans))
+	return repository.Session.Query(query_string, ban.User, ban.Type, ban.Reason, ban.CreatedAt, ban.ExpiresAt).WithContext(ctx).Exec()
+}
+
+func (repository *CassandraPixelRepository) RemoveBan(ctx context.Context, user string) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	query_string := fmt.Sprintf("DELETE FROM %s WHERE user=?", repository.table(repository.Tables.Bans))
+	return repository.Session.Query(query_string, user).WithContext(ctx).Exec()
+}
+
+var _ UserRepository = (*CassandraUserRepository)(nil)
+
+// CassandraUserRepository keeps accounts in the users table of notes.md, a nil Session makes every
+// call fail with ErrNotConnected
+type CassandraUserRepository struct {
+	Session  *gocql.Session
+	Keyspace string
+	Table    string
+}
+
+func NewCassandraUserRepository(session *gocql.Session, keyspace string, tables CassandraTables) *CassandraUserRepository {
+	return &CassandraUserRepository{Session: session, Keyspace: keyspace, Table: tables.Users}
+}
+
+// CreateUser inserts the user with a lightweight transaction so two registrations of the same name
+// can't both succeed
+func (repository *CassandraUserRepository) CreateUser(ctx context.Context, user string, passwordHash string, createdAt time.Time) error {
+	if repository.Session == nil {
+		return ErrNotConnected
+	}
+
+	query_string := fmt.Sprintf("INSERT INTO %s.%s (user, password_hash, created_at) VALUES (?, ?, ?) IF NOT EXISTS", repository.Keyspace, repository.Table)
+	applied, err := repository.Session.Query(query_string, user, passwordHash, createdAt).WithContext(ctx).MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+
+	if !applied {
+		return ErrUserExists
+	}
+
+	return nil
+}
+
+func (repository *CassandraUserRepository) GetPasswordHash(ctx context.Context, user string) (string, error) {
+	if repository.Session == nil {
+		return "", ErrNotConnected
+	}
+
+	var hash string
+	query_string := fmt.Sprintf("SELECT password_hash FROM %s.%s WHERE user=?", repository.Keyspace, repository.Table)
+	err := repository.Session.Query(query_string, user).WithContext(ctx).Scan(&hash)
+	if err == gocql.ErrNotFound {
+		return "", ErrNotFound
+	}
+
+	return hash, err
+}
@@ -0,0 +1,573 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/boardimage"
+	"Common/cooldown"
+)
+
+var _ BoardStore = (*MemoryBoardStore)(nil)
+var _ PixelRepository = (*MemoryPixelRepository)(nil)
+
+type memoryCooldown struct {
+	placedAt  int64 // unix seconds, like the cooldown keys in redis
+	expiresAt int64
+}
+
+type memoryTier struct {
+	tier      string
+	expiresAt time.Time // zero for good
+}
+
+// MemoryBoardStore is a BoardStore behaving like RedisBoardStore, for tests
+type MemoryBoardStore struct {
+	// clock of the cooldowns, time.Now when nil
+	Now func() time.Time
+	// every published update, oldest first
+	Updates []Update
+
+	mutex     sync.Mutex
+	metadata  *board.Metadata
+	bitfield  []uint8
+	seq       uint64
+	policy    cooldown.Policy
+	tiers     map[string]memoryTier
+	cooldowns map[string]memoryCooldown
+	bans      map[string]bans.Ban
+}
+
+func NewMemoryBoardStore() *MemoryBoardStore {
+	return &MemoryBoardStore{
+		policy:    cooldown.Policy{Default: int64(cooldown.DEFAULT_COOLDOWN / time.Second), Tiers: make(map[string]int64)},
+		tiers:     make(map[string]memoryTier),
+		cooldowns: make(map[string]memoryCooldown),
+		bans:      make(map[string]bans.Ban),
+	}
+}
+
+func (store *MemoryBoardStore) now() time.Time {
+	if store.Now == nil {
+		return time.Now()
+	}
+
+	return store.Now()
+}
+
+// boardMetadata returns the metadata of the board, the defaults while it is unset like in redis
+func (store *MemoryBoardStore) boardMetadata() board.Metadata {
+	if store.metadata == nil {
+		return board.DefaultMetadata()
+	}
+
+	return *store.metadata
+}
+
+// paddedBitfield returns the bitfield grown to the size of the board, redis reads missing bytes as 0
+func (store *MemoryBoardStore) paddedBitfield(metadata board.Metadata) []uint8 {
+	if len(store.bitfield) < metadata.BitfieldSize() {
+		store.bitfield = append(store.bitfield, make([]uint8, metadata.BitfieldSize()-len(store.bitfield))...)
+	}
+
+	return store.bitfield
+}
+
+func (store *MemoryBoardStore) PlacePixel(ctx context.Context, request PlaceRequest) (PlaceResult, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	metadata := store.boardMetadata()
+	if int(request.X) >= metadata.Width || int(request.Y) >= metadata.Height || int(request.Col) >= metadata.Colors() {
+		return PlaceResult{Status: PLACE_RESULT_INVALID}, nil
+	}
+
+	now := store.now().Unix()
+	seconds := int64(request.Cooldown / time.Second)
+	if last, ok := store.cooldowns[request.User]; ok && now < last.expiresAt {
+		left := last.placedAt + seconds - now
+		if left > 0 {
+			return PlaceResult{Status: PLACE_RESULT_COOLDOWN, SecondsLeft: left}, nil
+		}
+	}
+
+	store.cooldowns[request.User] = memoryCooldown{placedAt: now, expiresAt: now + int64(cooldown.MAX_COOLDOWN/time.Second)}
+
+	update := Update{Pos: uint32(request.Y)<<16 | uint32(request.X), Col: request.Col, User: request.User}
+	if request.Shadow {
+		update.Shadow = true
+		store.Updates = append(store.Updates, update)
+		return PlaceResult{Status: PLACE_RESULT_PLACED}, nil
+	}
+
+	boardimage.SetPixel(store.paddedBitfield(metadata), int(request.Y)*metadata.Width+int(request.X), metadata.BitsPerPixel, request.Col)
+
+	store.seq++
+	update.Seq = store.seq
+	store.Updates = append(store.Updates, update)
+
+	return PlaceResult{Status: PLACE_RESULT_PLACED, Seq: update.Seq}, nil
+}
+
+func (store *MemoryBoardStore) SetPixels(ctx context.Context, pixels []Pixel, metadata board.Metadata) (uint64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.boardMetadata() != metadata {
+		return 0, ErrBoardChanged
+	}
+
+	bitfield := store.paddedBitfield(metadata)
+	for _, pixel := range pixels {
+		boardimage.SetPixel(bitfield, int(pixel.Y)*metadata.Width+int(pixel.X), metadata.BitsPerPixel, pixel.Col)
+
+		store.seq++
+		store.Updates = append(store.Updates, Update{Pos: uint32(pixel.Y)<<16 | uint32(pixel.X), Col: pixel.Col, User: pixel.User, Seq: store.seq})
+	}
+
+	return store.seq, nil
+}
+
+func (store *MemoryBoardStore) GetPixel(ctx context.Context, x int, y int) (uint8, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	metadata := store.boardMetadata()
+	if x < 0 || x >= metadata.Width || y < 0 || y >= metadata.Height {
+		return 0, fmt.Errorf("pixel %d,%d is outside of the board", x, y)
+	}
+
+	return boardimage.GetPixel(store.paddedBitfield(metadata), y*metadata.Width+x, metadata.BitsPerPixel), nil
+}
+
+func (store *MemoryBoardStore) ReadBoard(ctx context.Context) ([]uint8, uint64, board.Metadata, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	metadata := store.boardMetadata()
+	bitfield := store.paddedBitfield(metadata)
+
+	return append([]uint8(nil), bitfield...), store.seq, metadata, nil
+}
+
+func (store *MemoryBoardStore) ReadRegion(ctx context.Context, region board.Region) ([]uint8, uint64, board.Metadata, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	metadata := store.boardMetadata()
+	if !metadata.Contains(region) {
+		return nil, 0, board.Metadata{}, fmt.Errorf("region %+v is outside of the board", region)
+	}
+
+	bitfield := store.paddedBitfield(metadata)
+	pixels := make([]uint8, (int(region.Width)*int(region.Height)*metadata.BitsPerPixel+7)/8)
+	for row := 0; row < int(region.Height); row++ {
+		for col := 0; col < int(region.Width); col++ {
+			color := boardimage.GetPixel(bitfield, (int(region.Y)+row)*metadata.Width+int(region.X)+col, metadata.BitsPerPixel)
+			boardimage.SetPixel(pixels, row*int(region.Width)+col, metadata.BitsPerPixel, color)
+		}
+	}
+
+	return pixels, store.seq, metadata, nil
+}
+
+func (store *MemoryBoardStore) GetVersion(ctx context.Context) (uint64, board.Metadata, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.seq, store.boardMetadata(), nil
+}
+
+func (store *MemoryBoardStore) GetMetadata(ctx context.Context) (board.Metadata, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.metadata == nil {
+		return board.Metadata{}, ErrNotFound
+	}
+
+	return *store.metadata, nil
+}
+
+func (store *MemoryBoardStore) WriteBoard(ctx context.Context, bitfield []uint8, metadata board.Metadata) error {
+	err := metadata.Validate()
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.bitfield = append([]uint8(nil), bitfield...)
+	store.metadata = &metadata
+	store.seq++
+
+	return nil
+}
+
+func (store *MemoryBoardStore) Expand(ctx context.Context, width int, height int) (board.Metadata, board.Metadata, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	from := store.boardMetadata()
+	if width < from.Width || height < from.Height {
+		return board.Metadata{}, board.Metadata{}, fmt.Errorf("%w, the board can only grow from %dx%d", board.ErrInvalidMetadata, from.Width, from.Height)
+	}
+
+	to := board.Metadata{Width: width, Height: height, BitsPerPixel: from.BitsPerPixel}
+	err := to.Validate()
+	if err != nil {
+		return board.Metadata{}, board.Metadata{}, err
+	}
+
+	store.bitfield = board.Relayout(store.paddedBitfield(from), from, to)
+	store.metadata = &to
+
+	return from, to, nil
+}
+
+// userCooldown returns the cooldown of the user under the current policy, the mutex must be held
+func (store *MemoryBoardStore) userCooldown(user string) time.Duration {
+	tier, ok := store.tiers[user]
+	if ok && !tier.expiresAt.IsZero() && !store.now().Before(tier.expiresAt) {
+		delete(store.tiers, user)
+		tier = memoryTier{}
+	}
+
+	return store.policy.Cooldown(tier.tier)
+}
+
+func (store *MemoryBoardStore) GetCooldown(ctx context.Context, user string) (time.Duration, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.userCooldown(user), nil
+}
+
+func (store *MemoryBoardStore) GetRemainingCooldown(ctx context.Context, user string) (time.Duration, time.Time, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Unix(store.now().Unix(), 0)
+	last, ok := store.cooldowns[user]
+	if !ok || now.Unix() >= last.expiresAt {
+		return 0, now, nil
+	}
+
+	remaining := time.Unix(last.placedAt, 0).Add(store.userCooldown(user)).Sub(now)
+	if remaining < 0 {
+		return 0, now, nil
+	}
+
+	return remaining, now, nil
+}
+
+func (store *MemoryBoardStore) GetCooldownPolicy(ctx context.Context) (cooldown.Policy, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	policy := cooldown.Policy{Default: store.policy.Default, Tiers: make(map[string]int64)}
+	for tier, seconds := range store.policy.Tiers {
+		policy.Tiers[tier] = seconds
+	}
+
+	return policy, nil
+}
+
+func (store *MemoryBoardStore) SetCooldownPolicy(ctx context.Context, policy cooldown.Policy) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.policy = cooldown.Policy{Default: policy.Default, Tiers: make(map[string]int64)}
+	for tier, seconds := range policy.Tiers {
+		store.policy.Tiers[tier] = seconds
+	}
+
+	return nil
+}
+
+func (store *MemoryBoardStore) SetTier(ctx context.Context, user string, tier string, duration time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if tier == "" {
+		delete(store.tiers, user)
+		return nil
+	}
+
+	userTier := memoryTier{tier: tier}
+	if duration > 0 {
+		userTier.expiresAt = store.now().Add(duration)
+	}
+	store.tiers[user] = userTier
+
+	return nil
+}
+
+func (store *MemoryBoardStore) GetBan(ctx context.Context, user string) (*bans.Ban, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	ban, ok := store.bans[user]
+	if !ok {
+		return nil, nil
+	}
+
+	if ban.Expired(time.Now()) {
+		delete(store.bans, user)
+		return nil, nil
+	}
+
+	return &ban, nil
+}
+
+func (store *MemoryBoardStore) SetBan(ctx context.Context, ban bans.Ban) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.bans[ban.User] = ban
+
+	return nil
+}
+
+func (store *MemoryBoardStore) RemoveBan(ctx context.Context, user string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.bans, user)
+
+	return nil
+}
+
+func (store *MemoryBoardStore) ListBans(ctx context.Context) ([]bans.Ban, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	active := []bans.Ban{}
+	for user, ban := range store.bans {
+		if ban.Expired(now) {
+			delete(store.bans, user)
+			continue
+		}
+
+		active = append(active, ban)
+	}
+
+	return active, nil
+}
+
+type pixelPosition struct {
+	X uint16
+	Y uint16
+}
+
+// MemoryPixelRepository is a PixelRepository kept in maps, for tests
+type MemoryPixelRepository struct {
+	// bans returned by ScanBans
+	Bans []bans.Ban
+	// rows Scan reports as unreadable after the pixels
+	BadRows int
+
+	mutex      sync.Mutex
+	pixels     map[pixelPosition]Pixel
+	history    map[pixelPosition][]Placement // oldest first
+	placements []memoryPlacement             // in the order they were upserted
+}
+
+type memoryPlacement struct {
+	pixel Pixel
+	seq   uint64
+	ts    time.Time
+}
+
+func NewMemoryPixelRepository() *MemoryPixelRepository {
+	return &MemoryPixelRepository{
+		pixels:  make(map[pixelPosition]Pixel),
+		history: make(map[pixelPosition][]Placement),
+	}
+}
+
+func (repository *MemoryPixelRepository) Upsert(ctx context.Context, pixel Pixel, seq uint64, ts time.Time) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	position := pixelPosition{X: pixel.X, Y: pixel.Y}
+	repository.pixels[position] = pixel
+	repository.history[position] = append(repository.history[position], Placement{Col: pixel.Col, User: pixel.User, Timestamp: ts})
+	repository.placements = append(repository.placements, memoryPlacement{pixel: pixel, seq: seq, ts: ts})
+
+	return nil
+}
+
+func (repository *MemoryPixelRepository) Read(ctx context.Context, x uint16, y uint16) (Pixel, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	pixel, ok := repository.pixels[pixelPosition{X: x, Y: y}]
+	if !ok {
+		return Pixel{}, ErrNotFound
+	}
+
+	return pixel, nil
+}
+
+func (repository *MemoryPixelRepository) History(ctx context.Context, x uint16, y uint16, limit int) ([]Placement, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	placements := repository.history[pixelPosition{X: x, Y: y}]
+	history := []Placement{}
+	for i := len(placements) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, placements[i])
+	}
+
+	return history, nil
+}
+
+func (repository *MemoryPixelRepository) ReadAt(ctx context.Context, x uint16, y uint16, ts time.Time) (Placement, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	placements := repository.history[pixelPosition{X: x, Y: y}]
+	for i := len(placements) - 1; i >= 0; i-- {
+		if !placements[i].Timestamp.After(ts) {
+			return placements[i], nil
+		}
+	}
+
+	return Placement{}, ErrNotFound
+}
+
+func (repository *MemoryPixelRepository) Scan(ctx context.Context, fn func(Pixel, error) error) error {
+	repository.mutex.Lock()
+	pixels := make([]Pixel, 0, len(repository.pixels))
+	for _, pixel := range repository.pixels {
+		pixels = append(pixels, pixel)
+	}
+	repository.mutex.Unlock()
+
+	for _, pixel := range pixels {
+		err := fn(pixel, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < repository.BadRows; i++ {
+		err := fn(Pixel{}, &ScanError{Err: errors.New("bad row")})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryPixelRepository) ScanPlacements(ctx context.Context, from time.Time, to time.Time, fn func(pixel Pixel, seq uint64, ts time.Time) error) error {
+	repository.mutex.Lock()
+	placements := []memoryPlacement{}
+	for _, placement := range repository.placements {
+		if !placement.ts.Before(from) && placement.ts.Before(to) {
+			placements = append(placements, placement)
+		}
+	}
+	repository.mutex.Unlock()
+
+	sort.SliceStable(placements, func(i, j int) bool { return placements[i].ts.Before(placements[j].ts) })
+	for _, placement := range placements {
+		err := fn(placement.pixel, placement.seq, placement.ts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryPixelRepository) ScanBans(ctx context.Context, fn func(bans.Ban) error) error {
+	repository.mutex.Lock()
+	saved := append([]bans.Ban(nil), repository.Bans...)
+	repository.mutex.Unlock()
+
+	for _, ban := range saved {
+		err := fn(ban)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repository *MemoryPixelRepository) SaveBan(ctx context.Context, ban bans.Ban) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.removeBan(ban.User)
+	repository.Bans = append(repository.Bans, ban)
+
+	return nil
+}
+
+func (repository *MemoryPixelRepository) RemoveBan(ctx context.Context, user string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	repository.removeBan(user)
+
+	return nil
+}
+
+// removeBan drops the ban of the user from Bans, the mutex must be held
+func (repository *MemoryPixelRepository) removeBan(user string) {
+	kept := repository.Bans[:0]
+	for _, ban := range repository.Bans {
+		if ban.User != user {
+			kept = append(kept, ban)
+		}
+	}
+	repository.Bans = kept
+}
+
+var _ UserRepository = (*MemoryUserRepository)(nil)
+
+// MemoryUserRepository is a UserRepository kept in a map, for tests
+type MemoryUserRepository struct {
+	mutex  sync.Mutex
+	hashes map[string]string
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{hashes: make(map[string]string)}
+}
+
+func (repository *MemoryUserRepository) CreateUser(ctx context.Context, user string, passwordHash string, createdAt time.Time) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	if _, ok := repository.hashes[user]; ok {
+		return ErrUserExists
+	}
+	repository.hashes[user] = passwordHash
+
+	return nil
+}
+
+func (repository *MemoryUserRepository) GetPasswordHash(ctx context.Context, user string) (string, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+
+	hash, ok := repository.hashes[user]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return hash, nil
+}
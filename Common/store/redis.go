@@ -0,0 +1,445 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/boardimage"
+	"Common/cooldown"
+
+	"github.com/go-redis/redis/v9"
+)
+
+const REDIS_SEQUENCE_KEY = "BoardSequence"    // incremented on every accepted write, doubles as the board version
+const REDIS_UPDATE_LOG_KEY = "BoardUpdateLog" // sorted set of published pixels scored by sequence number
+const REDIS_UPDATE_LOG_LENGTH = 1000
+const BOARD_UPDATE_STREAM = "BoardUpdateStream"
+const BOARD_UPDATE_STREAM_FIELD = "pixel"
+const BOARD_UPDATE_STREAM_LENGTH = 10000                  // approximate, trimmed by redis in whole nodes
+const REDIS_BITFIELD_REBUILD_KEY = "BoardBitfieldRebuild" // renamed over the bitfield by WriteBoard
+const REDIS_BITFIELD_REBUILD_TTL = 10 * time.Minute
+
+// checks the cooldown of the user, writes the pixel, arms the cooldown and publishes the update in
+// one step so concurrent writes of a user can't both get past the cooldown. the cooldown key holds
+// the unix time of the last placement so a changed policy also applies to users already waiting.
+// the board metadata is read here too so a pixel can't land in the wrong place while the board
+// is being re-laid out, see board.Redis_Relayout
+//
+// KEYS: cooldown key of the user, board bitfield, sequence, update log, update stream, board metadata
+// ARGV: x, y, color, cooldown seconds, user, shadow ("1" or "0"), default board width, default
+// board height, default bits per pixel, update log length, update stream length, update stream
+// field, longest cooldown seconds
+//
+// returns {"placed", seq}, {"cooldown", seconds left} or {"invalid"}
+var g_placePixelScript = redis.NewScript(`
+local x = tonumber(ARGV[1])
+local y = tonumber(ARGV[2])
+local color = tonumber(ARGV[3])
+local width = tonumber(redis.call("HGET", KEYS[6], "width") or ARGV[7])
+local height = tonumber(redis.call("HGET", KEYS[6], "height") or ARGV[8])
+local bits = tonumber(redis.call("HGET", KEYS[6], "bitsPerPixel") or ARGV[9])
+if not x or not y or not color or x < 0 or x >= width or y < 0 or y >= height or color < 0 or color >= 2 ^ bits then
+	return {"invalid"}
+end
+local index = y * width + x
+
+local cooldown = tonumber(ARGV[4])
+local now = tonumber(redis.call("TIME")[1])
+local last = redis.call("GET", KEYS[1])
+if last then
+	local left = tonumber(last) + cooldown - now
+	if left > 0 then
+		return {"cooldown", left}
+	end
+end
+
+-- kept for the longest cooldown rather than the current one, a raised cooldown then also applies
+-- to this placement
+redis.call("SET", KEYS[1], now, "EX", ARGV[13])
+
+local pixel = {Pos = y * 65536 + x, Col = color, User = ARGV[5], Seq = 0}
+if ARGV[6] == "1" then
+	-- writes of shadow-banned users are only echoed back to them, they never reach the board
+	pixel.Shadow = true
+	redis.call("XADD", KEYS[5], "MAXLEN", "~", ARGV[11], "*", ARGV[12], cjson.encode(pixel))
+	return {"placed", 0}
+end
+
+-- the bits of the pixel, high bit first, same bits as BITFIELD SET u<bits> #index
+for bit = 0, bits - 1 do
+	redis.call("SETBIT", KEYS[2], index * bits + bit, math.floor(color / 2 ^ (bits - 1 - bit)) % 2)
+end
+
+-- every accepted write gets the next sequence number so clients can tell which updates they missed
+pixel.Seq = redis.call("INCR", KEYS[3])
+local serialized = cjson.encode(pixel)
+
+-- keep the last few updates around so reconnecting clients can replay what they missed
+redis.call("ZADD", KEYS[4], pixel.Seq, serialized)
+redis.call("ZREMRANGEBYRANK", KEYS[4], 0, -(tonumber(ARGV[10]) + 1))
+redis.call("XADD", KEYS[5], "MAXLEN", "~", ARGV[11], "*", ARGV[12], serialized)
+
+return {"placed", pixel.Seq}
+`)
+
+// writes pixels laid out for the given metadata, gives them the next sequence numbers and publishes
+// them in one step like g_placePixelScript, so a board snapshot and its version always agree and the
+// update log never has a hole a concurrent placement could be logged past
+//
+// KEYS: board bitfield, sequence, update log, update stream, board metadata
+// ARGV: width, height and bits per pixel the pixels are laid out for, default board width, default
+// board height, default bits per pixel, update log length, update stream length, update stream
+// field, then x, y, color and user of every pixel
+//
+// returns the board version after the write, -1 when the board is no longer laid out for the metadata
+var g_setPixelsScript = redis.NewScript(`
+local width = tonumber(redis.call("HGET", KEYS[5], "width") or ARGV[4])
+local height = tonumber(redis.call("HGET", KEYS[5], "height") or ARGV[5])
+local bits = tonumber(redis.call("HGET", KEYS[5], "bitsPerPixel") or ARGV[6])
+if width ~= tonumber(ARGV[1]) or height ~= tonumber(ARGV[2]) or bits ~= tonumber(ARGV[3]) then
+	return -1
+end
+
+local seq = tonumber(redis.call("GET", KEYS[2]) or "0")
+for i = 10, #ARGV, 4 do
+	local x = tonumber(ARGV[i])
+	local y = tonumber(ARGV[i + 1])
+	local color = tonumber(ARGV[i + 2])
+
+	-- the bits of the pixel, high bit first, like g_placePixelScript
+	local index = y * width + x
+	for bit = 0, bits - 1 do
+		redis.call("SETBIT", KEYS[1], index * bits + bit, math.floor(color / 2 ^ (bits - 1 - bit)) % 2)
+	end
+
+	seq = redis.call("INCR", KEYS[2])
+	local serialized = cjson.encode({Pos = y * 65536 + x, Col = color, User = ARGV[i + 3], Seq = seq})
+	redis.call("ZADD", KEYS[3], seq, serialized)
+	redis.call("XADD", KEYS[4], "MAXLEN", "~", ARGV[8], "*", ARGV[9], serialized)
+end
+redis.call("ZREMRANGEBYRANK", KEYS[3], 0, -(tonumber(ARGV[7]) + 1))
+
+return seq
+`)
+
+// reads a pixel with the metadata it was written under, like g_placePixelScript
+//
+// KEYS: board bitfield, board metadata
+// ARGV: x, y, default board width, default board height, default bits per pixel
+//
+// returns the color index of the pixel, -1 when it is outside of the board
+var g_getPixelScript = redis.NewScript(`
+local x = tonumber(ARGV[1])
+local y = tonumber(ARGV[2])
+local width = tonumber(redis.call("HGET", KEYS[2], "width") or ARGV[3])
+local height = tonumber(redis.call("HGET", KEYS[2], "height") or ARGV[4])
+local bits = tonumber(redis.call("HGET", KEYS[2], "bitsPerPixel") or ARGV[5])
+if x < 0 or x >= width or y < 0 or y >= height then
+	return -1
+end
+
+local index = y * width + x
+local color = 0
+for bit = 0, bits - 1 do
+	color = color * 2 + redis.call("GETBIT", KEYS[1], index * bits + bit)
+end
+
+return color
+`)
+
+var _ BoardStore = (*RedisBoardStore)(nil)
+
+// RedisBoardStore keeps the board in the keys shared with the other lambdas and the servers
+type RedisBoardStore struct {
+	Client *redis.Client
+}
+
+func NewRedisBoardStore(client *redis.Client) *RedisBoardStore {
+	return &RedisBoardStore{Client: client}
+}
+
+// PlacePixel places the pixel of a user that is not on cooldown, see g_placePixelScript
+func (store *RedisBoardStore) PlacePixel(ctx context.Context, request PlaceRequest) (PlaceResult, error) {
+	shadowArg := "0"
+	if request.Shadow {
+		shadowArg = "1"
+	}
+
+	keys := []string{cooldown.REDIS_COOLDOWN_KEY_PREFIX + request.User, board.REDIS_BITFIELD_KEY, REDIS_SEQUENCE_KEY, REDIS_UPDATE_LOG_KEY, BOARD_UPDATE_STREAM, board.REDIS_BOARD_METADATA_KEY}
+	args := []interface{}{
+		request.X,
+		request.Y,
+		request.Col,
+		int64(request.Cooldown / time.Second),
+		request.User,
+		shadowArg,
+		board.DEFAULT_WIDTH,
+		board.DEFAULT_HEIGHT,
+		board.DEFAULT_BITS_PER_PIXEL,
+		REDIS_UPDATE_LOG_LENGTH,
+		BOARD_UPDATE_STREAM_LENGTH,
+		BOARD_UPDATE_STREAM_FIELD,
+		int64(cooldown.MAX_COOLDOWN / time.Second),
+	}
+
+	reply, err := g_placePixelScript.Run(ctx, store.Client, keys, args...).Slice()
+	if err != nil {
+		return PlaceResult{}, err
+	}
+
+	status, _ := reply[0].(string)
+	result := PlaceResult{Status: status}
+	switch status {
+	case PLACE_RESULT_PLACED:
+		seq, _ := reply[1].(int64)
+		result.Seq = uint64(seq)
+	case PLACE_RESULT_COOLDOWN:
+		result.SecondsLeft, _ = reply[1].(int64)
+	case PLACE_RESULT_INVALID:
+	default:
+		return PlaceResult{}, fmt.Errorf("unexpected place pixel result %v", reply)
+	}
+
+	return result, nil
+}
+
+func (store *RedisBoardStore) SetPixels(ctx context.Context, pixels []Pixel, metadata board.Metadata) (uint64, error) {
+	keys := []string{board.REDIS_BITFIELD_KEY, REDIS_SEQUENCE_KEY, REDIS_UPDATE_LOG_KEY, BOARD_UPDATE_STREAM, board.REDIS_BOARD_METADATA_KEY}
+	args := []interface{}{
+		metadata.Width,
+		metadata.Height,
+		metadata.BitsPerPixel,
+		board.DEFAULT_WIDTH,
+		board.DEFAULT_HEIGHT,
+		board.DEFAULT_BITS_PER_PIXEL,
+		REDIS_UPDATE_LOG_LENGTH,
+		BOARD_UPDATE_STREAM_LENGTH,
+		BOARD_UPDATE_STREAM_FIELD,
+	}
+	for _, pixel := range pixels {
+		args = append(args, pixel.X, pixel.Y, pixel.Col, pixel.User)
+	}
+
+	version, err := g_setPixelsScript.Run(ctx, store.Client, keys, args...).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if version < 0 {
+		return 0, ErrBoardChanged
+	}
+
+	return uint64(version), nil
+}
+
+func (store *RedisBoardStore) GetPixel(ctx context.Context, x int, y int) (uint8, error) {
+	keys := []string{board.REDIS_BITFIELD_KEY, board.REDIS_BOARD_METADATA_KEY}
+	color, err := g_getPixelScript.Run(ctx, store.Client, keys, x, y, board.DEFAULT_WIDTH, board.DEFAULT_HEIGHT, board.DEFAULT_BITS_PER_PIXEL).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if color < 0 {
+		return 0, fmt.Errorf("pixel %d,%d is outside of the board", x, y)
+	}
+
+	return uint8(color), nil
+}
+
+// ReadBoard reads the bitfield, the board version and the metadata in one transaction, so the
+// version is exactly the sequence number of the last write the bitfield contains and the bitfield
+// is laid out for the metadata
+func (store *RedisBoardStore) ReadBoard(ctx context.Context) ([]uint8, uint64, board.Metadata, error) {
+	tx := store.Client.TxPipeline()
+	bitfieldCmd := tx.Get(ctx, board.REDIS_BITFIELD_KEY)
+	versionCmd := tx.Get(ctx, REDIS_SEQUENCE_KEY)
+	metadataCmd := tx.HGetAll(ctx, board.REDIS_BOARD_METADATA_KEY)
+	_, err := tx.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, 0, board.Metadata{}, err
+	}
+
+	metadata, err := board.ParseMetadata(metadataCmd.Val())
+	if err != nil {
+		return nil, 0, board.Metadata{}, err
+	}
+
+	version, err := parseVersion(versionCmd)
+	if err != nil {
+		return nil, 0, board.Metadata{}, err
+	}
+
+	// redis drops the trailing bytes no pixel was written to
+	bitfield := []uint8(bitfieldCmd.Val())
+	if len(bitfield) < metadata.BitfieldSize() {
+		bitfield = append(bitfield, make([]uint8, metadata.BitfieldSize()-len(bitfield))...)
+	}
+
+	return bitfield, version, metadata, nil
+}
+
+// ReadRegion reads only the bytes of the bitfield covering region, along with the board version
+// in the same transaction, and repacks them so the region is laid out like the full board
+func (store *RedisBoardStore) ReadRegion(ctx context.Context, region board.Region) ([]uint8, uint64, board.Metadata, error) {
+	metadata, err := board.Redis_GetMetadata(ctx, store.Client)
+	if err != nil {
+		return nil, 0, board.Metadata{}, err
+	}
+
+	for {
+		if !metadata.Contains(region) {
+			return nil, 0, board.Metadata{}, fmt.Errorf("region %+v is outside of the board", region)
+		}
+
+		bits := metadata.BitsPerPixel
+		tx := store.Client.TxPipeline()
+		rows := make([]*redis.StringCmd, region.Height)
+		for row := 0; row < int(region.Height); row++ {
+			first := (int(region.Y)+row)*metadata.Width + int(region.X)
+			last := first + int(region.Width) - 1
+			rows[row] = tx.GetRange(ctx, board.REDIS_BITFIELD_KEY, int64(first*bits/8), int64(((last+1)*bits-1)/8))
+		}
+		versionCmd := tx.Get(ctx, REDIS_SEQUENCE_KEY)
+		metadataCmd := tx.HGetAll(ctx, board.REDIS_BOARD_METADATA_KEY)
+		_, err := tx.Exec(ctx)
+		if err != nil && err != redis.Nil {
+			return nil, 0, board.Metadata{}, err
+		}
+
+		// re-laid out since the metadata was read, the rows were read at the wrong offsets
+		current, err := board.ParseMetadata(metadataCmd.Val())
+		if err != nil {
+			return nil, 0, board.Metadata{}, err
+		}
+		if current != metadata {
+			metadata = current
+			continue
+		}
+
+		version, err := parseVersion(versionCmd)
+		if err != nil {
+			return nil, 0, board.Metadata{}, err
+		}
+
+		pixels := make([]uint8, (int(region.Width)*int(region.Height)*bits+7)/8)
+		for row := 0; row < int(region.Height); row++ {
+			bytes := []uint8(rows[row].Val())
+			first := (int(region.Y)+row)*metadata.Width + int(region.X)
+			for col := 0; col < int(region.Width); col++ {
+				// bit relative to the first byte that was read for this row
+				bit := first*bits%8 + col*bits
+				boardimage.SetPixel(pixels, row*int(region.Width)+col, bits, boardimage.GetBits(bytes, bit, bits))
+			}
+		}
+
+		return pixels, version, metadata, nil
+	}
+}
+
+// parseVersion reads the sequence, a board nothing was written to since it was initialized has no
+// version yet
+func parseVersion(versionCmd *redis.StringCmd) (uint64, error) {
+	version, err := versionCmd.Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+
+	return version, err
+}
+
+func (store *RedisBoardStore) GetVersion(ctx context.Context) (uint64, board.Metadata, error) {
+	tx := store.Client.TxPipeline()
+	versionCmd := tx.Get(ctx, REDIS_SEQUENCE_KEY)
+	metadataCmd := tx.HGetAll(ctx, board.REDIS_BOARD_METADATA_KEY)
+	_, err := tx.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return 0, board.Metadata{}, err
+	}
+
+	metadata, err := board.ParseMetadata(metadataCmd.Val())
+	if err != nil {
+		return 0, board.Metadata{}, err
+	}
+
+	version, err := parseVersion(versionCmd)
+	return version, metadata, err
+}
+
+func (store *RedisBoardStore) GetMetadata(ctx context.Context) (board.Metadata, error) {
+	fields, err := store.Client.HGetAll(ctx, board.REDIS_BOARD_METADATA_KEY).Result()
+	if err != nil {
+		return board.Metadata{}, err
+	}
+	if len(fields) == 0 {
+		return board.Metadata{}, ErrNotFound
+	}
+
+	return board.ParseMetadata(fields)
+}
+
+func (store *RedisBoardStore) WriteBoard(ctx context.Context, bitfield []uint8, metadata board.Metadata) error {
+	err := metadata.Validate()
+	if err != nil {
+		return err
+	}
+
+	// the new bitfield is uploaded next to the live one and renamed over it, readers see either the
+	// old board or the new one. it expires in case the rename never happens
+	err = store.Client.Set(ctx, REDIS_BITFIELD_REBUILD_KEY, bitfield, REDIS_BITFIELD_REBUILD_TTL).Err()
+	if err != nil {
+		return err
+	}
+
+	// the new board gets a version of its own and the updates of the old one can't be replayed on
+	// it, clients resuming from an older version find a gap and download the new board
+	tx := store.Client.TxPipeline()
+	tx.Rename(ctx, REDIS_BITFIELD_REBUILD_KEY, board.REDIS_BITFIELD_KEY)
+	tx.Persist(ctx, board.REDIS_BITFIELD_KEY)
+	board.Redis_SetMetadata(ctx, tx, metadata)
+	tx.Incr(ctx, REDIS_SEQUENCE_KEY)
+	tx.Del(ctx, REDIS_UPDATE_LOG_KEY)
+	_, err = tx.Exec(ctx)
+
+	return err
+}
+
+func (store *RedisBoardStore) Expand(ctx context.Context, width int, height int) (board.Metadata, board.Metadata, error) {
+	return board.Redis_Expand(ctx, store.Client, width, height)
+}
+
+func (store *RedisBoardStore) GetCooldown(ctx context.Context, user string) (time.Duration, error) {
+	return cooldown.Redis_GetCooldown(ctx, store.Client, user)
+}
+
+func (store *RedisBoardStore) GetRemainingCooldown(ctx context.Context, user string) (time.Duration, time.Time, error) {
+	return cooldown.Redis_GetRemaining(ctx, store.Client, user)
+}
+
+func (store *RedisBoardStore) GetCooldownPolicy(ctx context.Context) (cooldown.Policy, error) {
+	return cooldown.Redis_GetPolicy(ctx, store.Client)
+}
+
+func (store *RedisBoardStore) SetCooldownPolicy(ctx context.Context, policy cooldown.Policy) error {
+	return cooldown.Redis_SetPolicy(ctx, store.Client, policy)
+}
+
+func (store *RedisBoardStore) SetTier(ctx context.Context, user string, tier string, duration time.Duration) error {
+	return cooldown.Redis_SetTier(ctx, store.Client, user, tier, duration)
+}
+
+func (store *RedisBoardStore) GetBan(ctx context.Context, user string) (*bans.Ban, error) {
+	return bans.Redis_GetBan(ctx, store.Client, user)
+}
+
+func (store *RedisBoardStore) SetBan(ctx context.Context, ban bans.Ban) error {
+	return bans.Redis_SetBan(ctx, store.Client, ban)
+}
+
+func (store *RedisBoardStore) RemoveBan(ctx context.Context, user string) error {
+	return bans.Redis_RemoveBan(ctx, store.Client, user)
+}
+
+func (store *RedisBoardStore) ListBans(ctx context.Context) ([]bans.Ban, error) {
+	return bans.Redis_ListBans(ctx, store.Client)
+}
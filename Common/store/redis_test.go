@@ -0,0 +1,443 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"Common/board"
+	"Common/boardimage"
+	"Common/cooldown"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+const testCooldown = 5 * time.Minute
+
+// indices of palette.PALETTE
+const (
+	BLUE   uint8 = 2
+	RED    uint8 = 4
+	ORANGE uint8 = 5
+	VIOLET uint8 = 15
+)
+
+func setupRedis(t *testing.T) (*RedisBoardStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisBoardStore(client), server
+}
+
+// withCooldown sets the cooldown the write arms
+func withCooldown(request PlaceRequest, cooldown time.Duration) PlaceRequest {
+	request.Cooldown = cooldown
+	return request
+}
+
+func TestConcurrentWritesOfOneUserPlaceOnePixel(t *testing.T) {
+	store, _ := setupRedis(t)
+
+	const writers = 50
+	results := make(chan PlaceResult, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := store.PlacePixel(context.Background(), withCooldown(PlaceRequest{X: uint16(i), Y: 1, Col: RED, User: "alice"}, testCooldown))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			results <- result
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	statuses := make(map[string]int)
+	for result := range results {
+		statuses[result.Status]++
+		if result.Status == PLACE_RESULT_COOLDOWN && (result.SecondsLeft <= 0 || result.SecondsLeft > int64(testCooldown.Seconds())) {
+			t.Errorf("cooldown result has %d seconds left", result.SecondsLeft)
+		}
+	}
+
+	if statuses[PLACE_RESULT_PLACED] != 1 || statuses[PLACE_RESULT_COOLDOWN] != writers-1 {
+		t.Fatalf("expected 1 placed and %d on cooldown, got %v", writers-1, statuses)
+	}
+
+	seq, err := store.Client.Get(context.Background(), REDIS_SEQUENCE_KEY).Int()
+	if err != nil || seq != 1 {
+		t.Fatalf("expected the board version to be 1, got %d (%v)", seq, err)
+	}
+}
+
+func TestChangedCooldownAppliesToWaitingUsers(t *testing.T) {
+	store, server := setupRedis(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	server.SetTime(now)
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		cooldown time.Duration
+		status   string
+	}{
+		{"first pixel", 0, testCooldown, PLACE_RESULT_PLACED},
+		{"still on cooldown", time.Minute, testCooldown, PLACE_RESULT_COOLDOWN},
+		{"cooldown lowered below the elapsed time", 2 * time.Minute, time.Minute, PLACE_RESULT_PLACED},
+		{"cooldown disabled", 2 * time.Minute, 0, PLACE_RESULT_PLACED},
+		{"cooldown disabled again", 2 * time.Minute, 0, PLACE_RESULT_PLACED},
+	}
+
+	for i, test := range tests {
+		server.SetTime(now.Add(test.elapsed))
+		result, err := store.PlacePixel(ctx, withCooldown(PlaceRequest{X: uint16(i), Y: 0, Col: RED, User: "alice"}, test.cooldown))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != test.status {
+			t.Fatalf("%s: expected %q, got %q", test.name, test.status, result.Status)
+		}
+		if test.status == PLACE_RESULT_COOLDOWN && result.SecondsLeft != int64((test.cooldown-test.elapsed).Seconds()) {
+			t.Fatalf("%s: expected %v left, got %d seconds", test.name, test.cooldown-test.elapsed, result.SecondsLeft)
+		}
+	}
+}
+
+func TestRaisedCooldownAppliesToWaitingUsers(t *testing.T) {
+	store, server := setupRedis(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		cooldown time.Duration
+		status   string
+		left     time.Duration
+	}{
+		{"first pixel", 0, testCooldown, PLACE_RESULT_PLACED, 0},
+		{"cooldown raised after the old one ran out", 10 * time.Minute, time.Hour, PLACE_RESULT_COOLDOWN, 50 * time.Minute},
+		{"raised cooldown ran out", time.Hour, time.Hour, PLACE_RESULT_PLACED, 0},
+		{"placed without cooldown", time.Hour, 0, PLACE_RESULT_PLACED, 0},
+		{"cooldown raised again", time.Hour + time.Minute, testCooldown, PLACE_RESULT_COOLDOWN, 4 * time.Minute},
+	}
+
+	var previous time.Duration
+	for i, test := range tests {
+		// miniredis expires keys by FastForward only, not by the time it reports
+		server.SetTime(now.Add(test.elapsed))
+		server.FastForward(test.elapsed - previous)
+		previous = test.elapsed
+
+		result, err := store.PlacePixel(ctx, withCooldown(PlaceRequest{X: uint16(i), Y: 0, Col: RED, User: "alice"}, test.cooldown))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != test.status || result.SecondsLeft != int64(test.left/time.Second) {
+			t.Fatalf("%s: expected %q with %v left, got %q with %d seconds", test.name, test.status, test.left, result.Status, result.SecondsLeft)
+		}
+	}
+}
+
+func TestUsersNamedLikeBoardKeysLeaveTheBoardAlone(t *testing.T) {
+	store, server := setupRedis(t)
+	ctx := context.Background()
+	server.SetTime(time.Unix(1700000000, 0))
+
+	users := []string{board.REDIS_BITFIELD_KEY, board.REDIS_BOARD_METADATA_KEY, REDIS_SEQUENCE_KEY, REDIS_UPDATE_LOG_KEY, cooldown.REDIS_COOLDOWN_POLICY_KEY}
+	for i, user := range users {
+		result, err := store.PlacePixel(ctx, withCooldown(PlaceRequest{X: uint16(i), Y: 0, Col: RED, User: user}, testCooldown))
+		if err != nil || result.Status != PLACE_RESULT_PLACED || result.Seq != uint64(i+1) {
+			t.Fatalf("expected %s to place pixel %d, got %+v (%v)", user, i+1, result, err)
+		}
+	}
+
+	bitfield, version, metadata, err := store.ReadBoard(ctx)
+	if err != nil || version != uint64(len(users)) || metadata != board.DefaultMetadata() {
+		t.Fatalf("expected the default board at version %d, got %+v at %d (%v)", len(users), metadata, version, err)
+	}
+	for i := range users {
+		if boardimage.GetPixel(bitfield, i, metadata.BitsPerPixel) != RED {
+			t.Fatalf("expected pixel %d to be red", i)
+		}
+	}
+	if ttl := server.TTL(board.REDIS_BITFIELD_KEY); ttl != 0 {
+		t.Fatalf("expected the bitfield not to expire, got a ttl of %s", ttl)
+	}
+
+	_, err = store.GetCooldownPolicy(ctx)
+	if err != nil {
+		t.Fatalf("expected the cooldown policy to stay readable, got %v", err)
+	}
+
+	// the cooldown still applies to those users
+	remaining, _, err := store.GetRemainingCooldown(ctx, board.REDIS_BITFIELD_KEY)
+	if err != nil || remaining != cooldown.DEFAULT_COOLDOWN {
+		t.Fatalf("expected %s to wait %v, got %v (%v)", board.REDIS_BITFIELD_KEY, cooldown.DEFAULT_COOLDOWN, remaining, err)
+	}
+}
+
+func TestPixelsKeepTheirPlaceWhenTheBoardIsExpanded(t *testing.T) {
+	store, _ := setupRedis(t)
+	ctx := context.Background()
+
+	placed := []PlaceRequest{
+		{X: 999, Y: 0, Col: VIOLET, User: "alice"},
+		{X: 0, Y: 1, Col: ORANGE, User: "bob"},
+		{X: 998, Y: 999, Col: BLUE, User: "carol"},
+	}
+	for _, event := range placed {
+		result, err := store.PlacePixel(ctx, withCooldown(event, testCooldown))
+		if err != nil || result.Status != PLACE_RESULT_PLACED {
+			t.Fatalf("expected %+v to be placed, got %+v (%v)", event, result, err)
+		}
+	}
+
+	// outside of the board until it is expanded
+	outside := PlaceRequest{X: 1200, Y: 1100, Col: RED, User: "dave"}
+	result, err := store.PlacePixel(ctx, withCooldown(outside, testCooldown))
+	if err != nil || result.Status != PLACE_RESULT_INVALID {
+		t.Fatalf("expected %+v to be invalid, got %+v (%v)", outside, result, err)
+	}
+
+	expanded := board.Metadata{Width: 1500, Height: 1200, BitsPerPixel: board.DEFAULT_BITS_PER_PIXEL}
+	_, _, err = board.Redis_Expand(ctx, store.Client, expanded.Width, expanded.Height)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = store.PlacePixel(ctx, withCooldown(outside, testCooldown))
+	if err != nil || result.Status != PLACE_RESULT_PLACED {
+		t.Fatalf("expected %+v to be placed, got %+v (%v)", outside, result, err)
+	}
+
+	bitfield, _ := store.Client.Get(ctx, board.REDIS_BITFIELD_KEY).Bytes()
+	for _, event := range append(placed, outside) {
+		col := boardimage.GetPixel(bitfield, int(event.Y)*expanded.Width+int(event.X), expanded.BitsPerPixel)
+		if col != event.Col {
+			t.Fatalf("expected color %d at %d,%d, got %d", event.Col, event.X, event.Y, col)
+		}
+	}
+
+	_, _, err = board.Redis_Expand(ctx, store.Client, board.DEFAULT_WIDTH, board.DEFAULT_HEIGHT)
+	if err == nil {
+		t.Fatal("expected shrinking the board to fail")
+	}
+}
+
+func TestPixelsKeepTheirColorWhenTheyAreWidened(t *testing.T) {
+	store, _ := setupRedis(t)
+	ctx := context.Background()
+
+	placed := []PlaceRequest{
+		{X: 0, Y: 0, Col: VIOLET, User: "alice"},
+		{X: 1, Y: 0, Col: ORANGE, User: "bob"},
+		{X: 999, Y: 999, Col: BLUE, User: "carol"},
+	}
+	for _, event := range placed {
+		result, err := store.PlacePixel(ctx, withCooldown(event, testCooldown))
+		if err != nil || result.Status != PLACE_RESULT_PLACED {
+			t.Fatalf("expected %+v to be placed, got %+v (%v)", event, result, err)
+		}
+	}
+
+	wide := PlaceRequest{X: 500, Y: 500, Col: uint8(200), User: "dave"}
+	result, err := store.PlacePixel(ctx, withCooldown(wide, testCooldown))
+	if err != nil || result.Status != PLACE_RESULT_INVALID {
+		t.Fatalf("expected %+v to be invalid on a 16 color board, got %+v (%v)", wide, result, err)
+	}
+
+	_, widened, err := board.Redis_WidenPixels(ctx, store.Client, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = store.PlacePixel(ctx, withCooldown(wide, testCooldown))
+	if err != nil || result.Status != PLACE_RESULT_PLACED {
+		t.Fatalf("expected %+v to be placed, got %+v (%v)", wide, result, err)
+	}
+
+	bitfield, _ := store.Client.Get(ctx, board.REDIS_BITFIELD_KEY).Bytes()
+	if len(bitfield) != widened.BitfieldSize() {
+		t.Fatalf("expected a %d byte bitfield, got %d bytes", widened.BitfieldSize(), len(bitfield))
+	}
+	for _, event := range append(placed, wide) {
+		col := boardimage.GetPixel(bitfield, int(event.Y)*widened.Width+int(event.X), widened.BitsPerPixel)
+		if col != event.Col {
+			t.Fatalf("expected color %d at %d,%d, got %d", event.Col, event.X, event.Y, col)
+		}
+	}
+
+	_, _, err = board.Redis_WidenPixels(ctx, store.Client, 4)
+	if err == nil {
+		t.Fatal("expected narrowing the pixels to fail")
+	}
+}
+
+func TestPlacePixel(t *testing.T) {
+	tests := []struct {
+		name         string
+		bitsPerPixel int // of the board, the default when 0
+		event        PlaceRequest
+		shadow       bool
+		status       string
+		boardSet     bool // whether the pixel reaches the bitfield and the replay log
+	}{
+		{"placed in the high nibble", 0, PlaceRequest{X: 2, Y: 0, Col: VIOLET, User: "alice"}, false, PLACE_RESULT_PLACED, true},
+		{"placed in the low nibble", 0, PlaceRequest{X: 3, Y: 5, Col: ORANGE, User: "alice"}, false, PLACE_RESULT_PLACED, true},
+		{"shadow-banned", 0, PlaceRequest{X: 4, Y: 0, Col: BLUE, User: "alice"}, true, PLACE_RESULT_PLACED, false},
+		{"color out of range", 0, PlaceRequest{X: 0, Y: 0, Col: uint8(16), User: "alice"}, false, PLACE_RESULT_INVALID, false},
+		{"outside the board", 0, PlaceRequest{X: 0, Y: 1000, Col: RED, User: "alice"}, false, PLACE_RESULT_INVALID, false},
+		{"placed across two bytes", 5, PlaceRequest{X: 1, Y: 3, Col: uint8(31), User: "alice"}, false, PLACE_RESULT_PLACED, true},
+		{"color out of range of 5 bits", 5, PlaceRequest{X: 1, Y: 3, Col: uint8(32), User: "alice"}, false, PLACE_RESULT_INVALID, false},
+		{"placed in a whole byte", 8, PlaceRequest{X: 7, Y: 2, Col: uint8(255), User: "alice"}, false, PLACE_RESULT_PLACED, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, _ := setupRedis(t)
+			ctx := context.Background()
+
+			metadata := board.DefaultMetadata()
+			if test.bitsPerPixel != 0 {
+				metadata.BitsPerPixel = test.bitsPerPixel
+				board.Redis_SetMetadata(ctx, store.Client, metadata)
+			}
+
+			request := withCooldown(test.event, testCooldown)
+			request.Shadow = test.shadow
+			result, err := store.PlacePixel(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != test.status {
+				t.Fatalf("expected %q, got %q", test.status, result.Status)
+			}
+
+			index := int(test.event.X) + int(test.event.Y)*metadata.Width
+			bitfield, _ := store.Client.Get(ctx, board.REDIS_BITFIELD_KEY).Bytes()
+			col := boardimage.GetPixel(bitfield, index, metadata.BitsPerPixel)
+
+			logged := store.Client.ZCard(ctx, REDIS_UPDATE_LOG_KEY).Val()
+			if test.boardSet && (col != test.event.Col || logged != 1 || result.Seq != 1) {
+				t.Fatalf("expected color %d in the bitfield and 1 logged update with seq 1, got %d, %d and seq %d", test.event.Col, col, logged, result.Seq)
+			}
+			if !test.boardSet && (col != 0 || logged != 0) {
+				t.Fatalf("expected the board to be untouched, got color %d and %d logged updates", col, logged)
+			}
+
+			published := store.Client.XLen(ctx, BOARD_UPDATE_STREAM).Val()
+			if test.status == PLACE_RESULT_INVALID {
+				if published != 0 {
+					t.Fatalf("expected nothing to be published, got %d updates", published)
+				}
+				return
+			}
+
+			entries := store.Client.XRange(ctx, BOARD_UPDATE_STREAM, "-", "+").Val()
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 published update, got %d", len(entries))
+			}
+
+			var pixel Update
+			err = json.Unmarshal([]byte(entries[0].Values[BOARD_UPDATE_STREAM_FIELD].(string)), &pixel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := Update{Pos: (uint32(test.event.Y) << 16) | uint32(test.event.X), Col: test.event.Col, User: "alice", Seq: result.Seq, Shadow: test.shadow}
+			if pixel != expected {
+				t.Fatalf("expected %+v to be published, got %+v", expected, pixel)
+			}
+		})
+	}
+}
+
+func TestWriteBoardReplacesTheBitfieldAtOnce(t *testing.T) {
+	store, server := setupRedis(t)
+	ctx := context.Background()
+	metadata := board.Metadata{Width: 4, Height: 2, BitsPerPixel: 4}
+
+	// a bitfield left over from an earlier board is replaced, not merged into
+	server.Set(board.REDIS_BITFIELD_KEY, "\xff\xff\xff\xff\xff\xff\xff\xff")
+	store.PlacePixel(ctx, PlaceRequest{X: 0, Y: 0, Col: RED, User: "alice"})
+	bitfield := []uint8{0x40, 0, 0, 0x0f}
+	err := store.WriteBoard(ctx, bitfield, metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if server.Exists(REDIS_BITFIELD_REBUILD_KEY) {
+		t.Fatal("expected the rebuilt bitfield to be renamed")
+	}
+	if ttl := server.TTL(board.REDIS_BITFIELD_KEY); ttl != 0 {
+		t.Fatalf("expected the bitfield not to expire, got a ttl of %s", ttl)
+	}
+
+	// the updates of the replaced board can't be replayed on the new one
+	if server.Exists(REDIS_UPDATE_LOG_KEY) {
+		t.Fatal("expected the update log to be dropped")
+	}
+
+	written, version, writtenMetadata, err := store.ReadBoard(ctx)
+	if err != nil || version != 2 || writtenMetadata != metadata {
+		t.Fatalf("expected metadata %+v at version 2, got %+v at %d (%v)", metadata, writtenMetadata, version, err)
+	}
+	if string(written) != string(bitfield) {
+		t.Fatalf("expected bitfield %x, got %x", bitfield, written)
+	}
+}
+
+func TestSetPixelsLogsItsUpdatesWithoutHoles(t *testing.T) {
+	store, _ := setupRedis(t)
+	ctx := context.Background()
+	metadata := board.DefaultMetadata()
+
+	// placements racing a batch are logged either before or after all of it
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			store.PlacePixel(ctx, PlaceRequest{X: uint16(i), Y: 0, Col: RED, User: "user" + string(rune('a'+i))})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.SetPixels(ctx, []Pixel{{X: uint16(i), Y: 1, Col: BLUE, User: "[repair]"}, {X: uint16(i), Y: 2, Col: VIOLET, User: "[repair]"}}, metadata)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the stream is published in sequence order and the log holds every sequence number once
+	entries := store.Client.XRange(ctx, BOARD_UPDATE_STREAM, "-", "+").Val()
+	logged := store.Client.ZRangeWithScores(ctx, REDIS_UPDATE_LOG_KEY, 0, -1).Val()
+	if len(entries) != 60 || len(logged) != 60 {
+		t.Fatalf("expected 60 published and logged updates, got %d and %d", len(entries), len(logged))
+	}
+	for i, entry := range entries {
+		var update Update
+		err := json.Unmarshal([]byte(entry.Values[BOARD_UPDATE_STREAM_FIELD].(string)), &update)
+		if err != nil || update.Seq != uint64(i+1) || uint64(logged[i].Score) != update.Seq {
+			t.Fatalf("expected update %d to be published and logged in order, got %+v logged as %v (%v)", i+1, update, logged[i].Score, err)
+		}
+	}
+
+	pixel, _ := store.GetPixel(ctx, 19, 2)
+	version, _, _ := store.GetVersion(ctx)
+	if pixel != VIOLET || version != 60 {
+		t.Fatalf("expected the batches on the board at version 60, got color %d at %d", pixel, version)
+	}
+}
@@ -0,0 +1,198 @@
+// Package store puts the live board in redis and the pixel tables in cassandra behind interfaces,
+// so the lambdas can be handed in-memory stores in tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/cooldown"
+)
+
+// results of BoardStore.PlacePixel
+const (
+	PLACE_RESULT_PLACED   = "placed"
+	PLACE_RESULT_COOLDOWN = "cooldown"
+	PLACE_RESULT_INVALID  = "invalid"
+)
+
+// ErrNotFound is returned for pixels that were never written and boards without metadata
+var ErrNotFound = errors.New("not found")
+
+// ErrUserExists is returned by UserRepository.CreateUser when the username is taken
+var ErrUserExists = errors.New("username is taken")
+
+// ErrNotConnected is returned by a CassandraPixelRepository whose session could not be created
+var ErrNotConnected = errors.New("cannot connect to Keyspace")
+
+// ScanError is a row PixelRepository.Scan could not read
+type ScanError struct {
+	Err error
+}
+
+func (err *ScanError) Error() string {
+	return "cannot read row - " + err.Err.Error()
+}
+
+func (err *ScanError) Unwrap() error {
+	return err.Err
+}
+
+// ErrBoardChanged is returned by BoardStore.SetPixels when the board was expanded or its pixels
+// widened since its metadata was read
+var ErrBoardChanged = errors.New("the board was re-laid out")
+
+// Pixel is the latest write of a pixel
+type Pixel struct {
+	X    uint16 `json:"pixel_x"`
+	Y    uint16 `json:"pixel_y"`
+	Col  uint8  `json:"col"`
+	User string `json:"user"`
+}
+
+// Placement is one write to a pixel from its history
+type Placement struct {
+	Col       uint8     `json:"col"`
+	User      string    `json:"user"`
+	Timestamp time.Time `json:"ts"`
+}
+
+// Update is the pixel published on the board update stream for the servers to forward to clients
+type Update struct {
+	Pos  uint32 // x: uint16(Pos & uint16(1)), y: Pos >> 16
+	Col  uint8
+	User string // owner's username
+	Seq  uint64 // position of this write in the update stream
+
+	// set for writes of shadow-banned users, the servers only echo them to the user's own sockets
+	Shadow bool `json:",omitempty"`
+}
+
+type PlaceRequest struct {
+	X        uint16
+	Y        uint16
+	Col      uint8
+	User     string
+	Shadow   bool          // only echo the pixel back to the user, it never reaches the board
+	Cooldown time.Duration // of the user, armed when the pixel is placed
+}
+
+type PlaceResult struct {
+	Status      string
+	Seq         uint64 // sequence number of the placed pixel, 0 for shadow writes
+	SecondsLeft int64  // remaining cooldown when Status is PLACE_RESULT_COOLDOWN
+}
+
+// BoardStore is the live board along with what the lambdas check before writing to it
+type BoardStore interface {
+	// PlacePixel checks the cooldown of the user, writes the pixel, arms the cooldown and publishes
+	// the update in one step. Pixels outside of the board or with colors its bits per pixel can't
+	// hold are PLACE_RESULT_INVALID.
+	PlacePixel(ctx context.Context, request PlaceRequest) (PlaceResult, error)
+
+	// GetPixel returns the color index of a pixel
+	GetPixel(ctx context.Context, x int, y int) (uint8, error)
+
+	// SetPixels writes pixels to the board, without cooldowns, and publishes them like placed
+	// pixels. It fails with ErrBoardChanged unless the board is still laid out for metadata and
+	// returns the board version after the last pixel.
+	SetPixels(ctx context.Context, pixels []Pixel, metadata board.Metadata) (uint64, error)
+
+	// ReadBoard returns the packed pixels of the board, padded to its size, along with the version
+	// of the board they are at and its metadata
+	ReadBoard(ctx context.Context) ([]uint8, uint64, board.Metadata, error)
+
+	// ReadRegion returns the pixels of a region packed row by row like the board, along with the
+	// version and the metadata of the board they were read from. The board can only grow so a
+	// region stays valid when the board is re-laid out while it is read.
+	ReadRegion(ctx context.Context, region board.Region) ([]uint8, uint64, board.Metadata, error)
+
+	// GetVersion returns the version of the board and its metadata, the defaults when it was never
+	// set, without reading its pixels
+	GetVersion(ctx context.Context) (uint64, board.Metadata, error)
+
+	// GetMetadata returns the metadata of the board, ErrNotFound when it was never set
+	GetMetadata(ctx context.Context) (board.Metadata, error)
+
+	// WriteBoard replaces the pixels of the board and its metadata and moves the board to the next
+	// version, updates of the replaced board are no longer replayed
+	WriteBoard(ctx context.Context, bitfield []uint8, metadata board.Metadata) error
+
+	// Expand grows the board to width x height, keeping every pixel where it is, and returns the
+	// metadata before and after
+	Expand(ctx context.Context, width int, height int) (board.Metadata, board.Metadata, error)
+
+	// GetCooldown returns how long the user waits between two pixels under the current policy
+	GetCooldown(ctx context.Context, user string) (time.Duration, error)
+
+	// GetRemainingCooldown returns how long the user still waits before placing a pixel and the
+	// time of the store it was measured against
+	GetRemainingCooldown(ctx context.Context, user string) (time.Duration, time.Time, error)
+
+	GetCooldownPolicy(ctx context.Context) (cooldown.Policy, error)
+
+	// SetCooldownPolicy replaces the policy, it also applies to users already waiting
+	SetCooldownPolicy(ctx context.Context, policy cooldown.Policy) error
+
+	// SetTier moves the user to a tier for the given duration, 0 for good, an empty tier removes
+	// the user from its tier
+	SetTier(ctx context.Context, user string, tier string, duration time.Duration) error
+
+	// GetBan returns the active ban of the user, or nil if the user is not banned
+	GetBan(ctx context.Context, user string) (*bans.Ban, error)
+
+	// SetBan bans the user, replacing any previous ban
+	SetBan(ctx context.Context, ban bans.Ban) error
+
+	RemoveBan(ctx context.Context, user string) error
+
+	// ListBans returns every active ban
+	ListBans(ctx context.Context) ([]bans.Ban, error)
+}
+
+// PixelRepository is the durable record of the board every BoardStore can be rebuilt from
+type PixelRepository interface {
+	// Upsert makes pixel the latest write of its position and appends it to the placements and to
+	// the history of the pixel
+	Upsert(ctx context.Context, pixel Pixel, seq uint64, ts time.Time) error
+
+	// Read returns the latest write of a pixel, ErrNotFound if it was never written
+	Read(ctx context.Context, x uint16, y uint16) (Pixel, error)
+
+	// History returns the last limit writes of a pixel, most recent first
+	History(ctx context.Context, x uint16, y uint16, limit int) ([]Placement, error)
+
+	// ReadAt returns the write of a pixel that was the latest at ts, ErrNotFound if it was not
+	// written before ts
+	ReadAt(ctx context.Context, x uint16, y uint16, ts time.Time) (Placement, error)
+
+	// Scan calls fn with the latest write of every pixel, in no particular order, and stops at the
+	// first error fn returns. Rows that can't be read as a Pixel are passed to fn as a *ScanError
+	// so one bad row doesn't end the scan.
+	Scan(ctx context.Context, fn func(Pixel, error) error) error
+
+	// ScanPlacements calls fn with every write made in [from, to) in the order they were made, with
+	// the sequence number and time Upsert was given, and stops at the first error fn returns
+	ScanPlacements(ctx context.Context, from time.Time, to time.Time, fn func(pixel Pixel, seq uint64, ts time.Time) error) error
+
+	// ScanBans calls fn with every ban the Admin lambda mirrored, expired ones included
+	ScanBans(ctx context.Context, fn func(bans.Ban) error) error
+
+	// SaveBan mirrors a ban so it survives losing the BoardStore, see InitializeRedis
+	SaveBan(ctx context.Context, ban bans.Ban) error
+
+	RemoveBan(ctx context.Context, user string) error
+}
+
+// UserRepository keeps the accounts the Auth lambda issues session tokens for
+type UserRepository interface {
+	// CreateUser stores a new user, ErrUserExists if the username is taken
+	CreateUser(ctx context.Context, user string, passwordHash string, createdAt time.Time) error
+
+	// GetPasswordHash returns the bcrypt hash of the password of a user, ErrNotFound if there is
+	// no such user
+	GetPasswordHash(ctx context.Context, user string) (string, error)
+}
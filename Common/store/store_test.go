@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/boardimage"
+	"Common/cooldown"
+)
+
+// runs the same writes against every BoardStore so the in-memory one keeps behaving like redis
+func TestBoardStoresBehaveAlike(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	stores := []struct {
+		name     string
+		newStore func(t *testing.T) BoardStore
+	}{
+		{"redis", func(t *testing.T) BoardStore {
+			store, server := setupRedis(t)
+			server.SetTime(now)
+			return store
+		}},
+		{"memory", func(t *testing.T) BoardStore {
+			store := NewMemoryBoardStore()
+			store.Now = func() time.Time { return now }
+			return store
+		}},
+	}
+
+	for _, backend := range stores {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.newStore(t)
+			ctx := context.Background()
+
+			_, err := store.GetMetadata(ctx)
+			if err != ErrNotFound {
+				t.Fatalf("expected a board without metadata, got %v", err)
+			}
+
+			writes := []struct {
+				request PlaceRequest
+				result  PlaceResult
+			}{
+				{PlaceRequest{X: 1, Y: 2, Col: 3, User: "alice", Cooldown: testCooldown}, PlaceResult{Status: PLACE_RESULT_PLACED, Seq: 1}},
+				{PlaceRequest{X: 2, Y: 2, Col: 3, User: "alice", Cooldown: testCooldown}, PlaceResult{Status: PLACE_RESULT_COOLDOWN, SecondsLeft: 300}},
+				{PlaceRequest{X: 2, Y: 2, Col: 3, User: "alice", Cooldown: 0}, PlaceResult{Status: PLACE_RESULT_PLACED, Seq: 2}},
+				{PlaceRequest{X: 3, Y: 3, Col: 5, User: "bob", Shadow: true, Cooldown: testCooldown}, PlaceResult{Status: PLACE_RESULT_PLACED}},
+				{PlaceRequest{X: 0, Y: 1000, Col: 1, User: "carol", Cooldown: testCooldown}, PlaceResult{Status: PLACE_RESULT_INVALID}},
+				{PlaceRequest{X: 0, Y: 0, Col: 16, User: "carol", Cooldown: testCooldown}, PlaceResult{Status: PLACE_RESULT_INVALID}},
+			}
+			for _, write := range writes {
+				result, err := store.PlacePixel(ctx, write.request)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result != write.result {
+					t.Fatalf("expected %+v to give %+v, got %+v", write.request, write.result, result)
+				}
+			}
+
+			pixels := []struct {
+				x   int
+				y   int
+				col uint8
+			}{
+				{1, 2, 3},
+				{2, 2, 3},
+				{3, 3, 0}, // shadowed
+				{999, 999, 0},
+			}
+			for _, pixel := range pixels {
+				col, err := store.GetPixel(ctx, pixel.x, pixel.y)
+				if err != nil || col != pixel.col {
+					t.Fatalf("expected color %d at %d,%d, got %d (%v)", pixel.col, pixel.x, pixel.y, col, err)
+				}
+			}
+
+			_, err = store.GetPixel(ctx, 1000, 0)
+			if err == nil {
+				t.Fatal("expected reading outside of the board to fail")
+			}
+
+			// replaced by a smaller board with wider pixels
+			metadata := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 5}
+			bitfield := make([]uint8, metadata.BitfieldSize())
+			boardimage.SetPixel(bitfield, 4*metadata.Width+4, metadata.BitsPerPixel, 7)
+			err = store.WriteBoard(ctx, bitfield, metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := store.GetMetadata(ctx)
+			if err != nil || written != metadata {
+				t.Fatalf("expected metadata %+v, got %+v (%v)", metadata, written, err)
+			}
+
+			result, err := store.PlacePixel(ctx, PlaceRequest{X: 19, Y: 9, Col: 31, User: "dave", Cooldown: testCooldown})
+			if err != nil || result.Status != PLACE_RESULT_PLACED {
+				t.Fatalf("expected the pixel to be placed, got %+v (%v)", result, err)
+			}
+
+			// version 3 went to the written board and 4 to the placed pixel
+			version, err := store.SetPixels(ctx, []Pixel{{X: 0, Y: 0, Col: 9, User: "[repair]"}, {X: 19, Y: 0, Col: 12}}, metadata)
+			if err != nil || version != 6 {
+				t.Fatalf("expected the pixels to be set at version 6, got %d (%v)", version, err)
+			}
+			_, err = store.SetPixels(ctx, []Pixel{{X: 0, Y: 0, Col: 1}}, board.DefaultMetadata())
+			if err != ErrBoardChanged {
+				t.Fatalf("expected pixels set for another layout to be rejected, got %v", err)
+			}
+
+			read, readVersion, readMetadata, err := store.ReadBoard(ctx)
+			if err != nil || readVersion != 6 || readMetadata != metadata || len(read) != metadata.BitfieldSize() {
+				t.Fatalf("expected a %d byte board at version 6 with metadata %+v, got %d bytes at %d and %+v (%v)", metadata.BitfieldSize(), metadata, len(read), readVersion, readMetadata, err)
+			}
+			if boardimage.GetPixel(read, 4*metadata.Width+4, 5) != 7 || boardimage.GetPixel(read, 9*metadata.Width+19, 5) != 31 {
+				t.Fatal("expected the written and the placed pixel in the board")
+			}
+			if boardimage.GetPixel(read, 0, 5) != 9 || boardimage.GetPixel(read, 19, 5) != 12 {
+				t.Fatal("expected the set pixels in the board")
+			}
+
+			version, versionMetadata, err := store.GetVersion(ctx)
+			if err != nil || version != 6 || versionMetadata != metadata {
+				t.Fatalf("expected version 6 with metadata %+v, got %d and %+v (%v)", metadata, version, versionMetadata, err)
+			}
+
+			// the bottom right corner, with the placed pixel last
+			region, regionVersion, _, err := store.ReadRegion(ctx, board.Region{X: 17, Y: 8, Width: 3, Height: 2})
+			if err != nil || regionVersion != 6 || len(region) != 4 || boardimage.GetPixel(region, 5, 5) != 31 || boardimage.GetPixel(region, 0, 5) != 0 {
+				t.Fatalf("expected the 3x2 corner with the placed pixel at version 6, got %x at %d (%v)", region, regionVersion, err)
+			}
+			_, _, _, err = store.ReadRegion(ctx, board.Region{X: 18, Y: 0, Width: 3, Height: 1})
+			if err == nil {
+				t.Fatal("expected reading a region outside of the board to fail")
+			}
+
+			_, expanded, err := store.Expand(ctx, 30, 10)
+			if err != nil || expanded != (board.Metadata{Width: 30, Height: 10, BitsPerPixel: 5}) {
+				t.Fatalf("expected the board to be 30x10, got %+v (%v)", expanded, err)
+			}
+			col, err := store.GetPixel(ctx, 19, 9)
+			if err != nil || col != 31 {
+				t.Fatalf("expected the placed pixel to keep its place, got %d (%v)", col, err)
+			}
+			_, _, err = store.Expand(ctx, 20, 10)
+			if err == nil {
+				t.Fatal("expected shrinking the board to fail")
+			}
+
+			err = store.WriteBoard(ctx, nil, board.Metadata{Width: 20, Height: 10, BitsPerPixel: 3})
+			if err == nil {
+				t.Fatal("expected invalid metadata to be rejected")
+			}
+
+			expiredAt := time.Now().Add(-time.Hour)
+			active := bans.Ban{User: "erin", Type: bans.BAN_TYPE_BAN}
+			expired := bans.Ban{User: "frank", Type: bans.BAN_TYPE_SHADOW, ExpiresAt: &expiredAt}
+			for _, ban := range []bans.Ban{active, expired} {
+				err = store.SetBan(ctx, ban)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ban, err := store.GetBan(ctx, "erin")
+			if err != nil || ban == nil || ban.Type != bans.BAN_TYPE_BAN {
+				t.Fatalf("expected erin to be banned, got %+v (%v)", ban, err)
+			}
+			ban, err = store.GetBan(ctx, "frank")
+			if err != nil || ban != nil {
+				t.Fatalf("expected the ban of frank to have expired, got %+v (%v)", ban, err)
+			}
+
+			listed, err := store.ListBans(ctx)
+			if err != nil || len(listed) != 1 || listed[0].User != "erin" {
+				t.Fatalf("expected only the ban of erin, got %+v (%v)", listed, err)
+			}
+			err = store.RemoveBan(ctx, "erin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ban, err = store.GetBan(ctx, "erin")
+			if err != nil || ban != nil {
+				t.Fatalf("expected erin to be unbanned, got %+v (%v)", ban, err)
+			}
+
+			err = store.SetCooldownPolicy(ctx, cooldown.Policy{Default: 60, Tiers: map[string]int64{cooldown.TIER_NEW: 600}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy, err := store.GetCooldownPolicy(ctx)
+			if err != nil || policy.Default != 60 || policy.Tiers[cooldown.TIER_NEW] != 600 {
+				t.Fatalf("expected the policy to be saved, got %+v (%v)", policy, err)
+			}
+			err = store.SetTier(ctx, "dave", cooldown.TIER_NEW, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userCooldown, err := store.GetCooldown(ctx, "dave")
+			if err != nil || userCooldown != 10*time.Minute {
+				t.Fatalf("expected dave to wait the cooldown of new accounts, got %v (%v)", userCooldown, err)
+			}
+
+			// dave placed at now and waits the cooldown of the tier, not the one the pixel was placed with
+			remaining, measuredAt, err := store.GetRemainingCooldown(ctx, "dave")
+			if err != nil || remaining != 10*time.Minute || !measuredAt.Equal(now) {
+				t.Fatalf("expected dave to wait 10m at %v, got %v at %v (%v)", now, remaining, measuredAt, err)
+			}
+			remaining, _, err = store.GetRemainingCooldown(ctx, "carol")
+			if err != nil || remaining != 0 {
+				t.Fatalf("expected carol not to wait, got %v (%v)", remaining, err)
+			}
+		})
+	}
+}
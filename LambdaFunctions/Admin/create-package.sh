@@ -0,0 +1,4 @@
+#!/bin/bash
+GOOS=linux GOARCH=amd64 go build .
+zip Admin.zip Admin sf-class2-root.crt
+aws s3 cp Admin.zip s3://a3-test
@@ -0,0 +1,15 @@
+module Admin
+
+go 1.19
+
+require (
+	github.com/aws/aws-lambda-go v1.35.0
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/gocql/gocql v1.3.0
+)
+
+require (
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed // indirect
+	gopkg.in/inf.v0 v0.9.1 // indirect
+)
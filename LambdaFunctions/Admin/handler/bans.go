@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"Common/bans"
+)
+
+// HandleBan bans or shadow-bans a user, the body is a bans.Ban without CreatedAt
+func (handler Handler) HandleBan(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	var ban bans.Ban
+	err := DecodeRequestBody(request, &ban)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	ban.CreatedAt = time.Now()
+	err = ban.Validate()
+	if err == nil && ban.Expired(ban.CreatedAt) {
+		err = errors.New("ban expires in the past")
+	}
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	// cassandra first so a ban that is enforced is never lost
+	err = handler.Pixels.SaveBan(ctx, ban)
+	if err != nil {
+		log.Println("[KEYSPACE]: error in saving ban", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	err = handler.Board.SetBan(ctx, ban)
+	if err != nil {
+		log.Println("[REDIS]: Error saving ban", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[BANS] %s %s - %s\n", ban.Type, ban.User, ban.Reason)
+
+	return GetJSONResponse(ban)
+}
+
+// HandleUnban lifts the ban of the user in the user query parameter
+func (handler Handler) HandleUnban(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	user := request.QueryStringParameters["user"]
+	if user == "" {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), errors.New("missing user")
+	}
+
+	// redis first so the ban stops being enforced even if cassandra fails
+	err := handler.Board.RemoveBan(ctx, user)
+	if err != nil {
+		log.Println("[REDIS]: Error removing ban", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	err = handler.Pixels.RemoveBan(ctx, user)
+	if err != nil {
+		log.Println("[KEYSPACE]: error in removing ban", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[BANS] Unbanned %s\n", user)
+
+	return GetResponse(http.StatusOK, "200 OK"), nil
+}
+
+// HandleListBans returns every active ban
+func (handler Handler) HandleListBans(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	active, err := handler.Board.ListBans(ctx)
+	if err != nil {
+		log.Println("[REDIS]: Error listing bans", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	return GetJSONResponse(active)
+}
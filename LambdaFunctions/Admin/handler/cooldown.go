@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"Common/cooldown"
+)
+
+// TierRequest moves a user to a tier, an empty tier removes the user from its tier
+type TierRequest struct {
+	User    string `json:"user"`
+	Tier    string `json:"tier"`
+	Seconds int64  `json:"seconds"` // how long the user stays in the tier, 0 for good
+}
+
+// HandleGetCooldown returns the cooldown policy
+func (handler Handler) HandleGetCooldown(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	policy, err := handler.Board.GetCooldownPolicy(ctx)
+	if err != nil {
+		log.Println("[REDIS]: Error getting cooldown policy", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	return GetJSONResponse(policy)
+}
+
+// HandleSetCooldown replaces the cooldown policy, WritePixel and GetUser pick it up on their next request
+func (handler Handler) HandleSetCooldown(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	var policy cooldown.Policy
+	err := DecodeRequestBody(request, &policy)
+	if err == nil {
+		err = policy.Validate()
+	}
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	err = handler.Board.SetCooldownPolicy(ctx, policy)
+	if err != nil {
+		log.Println("[REDIS]: Error saving cooldown policy", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[COOLDOWN] Default %ds, tiers %v\n", policy.Default, policy.Tiers)
+
+	return GetJSONResponse(policy)
+}
+
+// HandleSetTier moves a user to a tier of the cooldown policy
+func (handler Handler) HandleSetTier(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	var tier TierRequest
+	err := DecodeRequestBody(request, &tier)
+	if err == nil && (tier.User == "" || (tier.Tier != "" && !cooldown.IsTier(tier.Tier)) || tier.Seconds < 0) {
+		err = errors.New("invalid tier request")
+	}
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	err = handler.Board.SetTier(ctx, tier.User, tier.Tier, time.Duration(tier.Seconds)*time.Second)
+	if err != nil {
+		log.Println("[REDIS]: Error saving tier of user", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[COOLDOWN] %s is now in tier %q\n", tier.User, tier.Tier)
+
+	return GetJSONResponse(tier)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"Common/board"
+)
+
+// HandleExpand grows the board to the width and height of the body, existing pixels keep their
+// coordinates and the new area is white. Clients pick up the new dimensions with their next snapshot.
+func (handler Handler) HandleExpand(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	var expanded board.Metadata
+	err := DecodeRequestBody(request, &expanded)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	previous, expanded, err := handler.Board.Expand(ctx, expanded.Width, expanded.Height)
+	if errors.Is(err, board.ErrInvalidMetadata) {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+	if err != nil {
+		log.Println("[REDIS]: Error expanding board", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[EXPAND] Board expanded from %dx%d to %dx%d\n", previous.Width, previous.Height, expanded.Width, expanded.Height)
+
+	return GetJSONResponse(expanded)
+}
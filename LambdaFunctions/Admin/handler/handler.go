@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"Common/config"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// header carrying the shared admin secret, the ALB lower-cases header names
+const ADMIN_TOKEN_HEADER = "x-admin-token"
+
+// Handler serves admin operations with the stores it is given, Init connects the one behind
+// HandleRequest to redis and cassandra
+type Handler struct {
+	Board  store.BoardStore
+	Pixels store.PixelRepository
+}
+
+var g_handler Handler
+
+var ErrUnauthorized = errors.New("missing or invalid admin token")
+
+func GetBase64DecodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.DecodedLen(len(buffer))
+	decodedBuffer := make([]byte, length)
+	n, _ := base64.StdEncoding.Decode(decodedBuffer, buffer)
+
+	return decodedBuffer[:n]
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+// GetJSONResponse serializes body as the json body of a 200 response
+func GetJSONResponse(body interface{}) (ALBResponse, error) {
+	serialized, err := json.Marshal(body)
+	if err != nil {
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	response := GetResponse(http.StatusOK, "200 OK")
+	response.Body = string(serialized)
+
+	return response, nil
+}
+
+// DecodeRequestBody unmarshals the json body of the request into out
+func DecodeRequestBody(request ALBRequest, out interface{}) error {
+	var rawRequest []byte = []byte(request.Body)
+	if request.IsBase64Encoded {
+		rawRequest = GetBase64DecodedBuffer([]byte(request.Body))
+	}
+
+	return json.Unmarshal(rawRequest, out)
+}
+
+// IsAuthorized checks the admin token header against ADMIN_TOKEN, every request is rejected
+// when ADMIN_TOKEN is not set
+func IsAuthorized(request ALBRequest) bool {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" {
+		return false
+	}
+
+	token := request.Headers[ADMIN_TOKEN_HEADER]
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// HandleRequest routes /api/admin/<operation> to the handler of the operation
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	if !IsAuthorized(request) {
+		return GetResponse(http.StatusUnauthorized, "401 Unauthorized"), ErrUnauthorized
+	}
+
+	operation := strings.Trim(strings.TrimPrefix(request.Path, "/api/admin"), "/")
+	switch {
+	case operation == "rollback" && request.HTTPMethod == http.MethodPost:
+		return handler.HandleRollback(ctx, request)
+	case operation == "bans" && request.HTTPMethod == http.MethodGet:
+		return handler.HandleListBans(ctx, request)
+	case operation == "bans" && request.HTTPMethod == http.MethodPost:
+		return handler.HandleBan(ctx, request)
+	case operation == "bans" && request.HTTPMethod == http.MethodDelete:
+		return handler.HandleUnban(ctx, request)
+	case operation == "cooldown" && request.HTTPMethod == http.MethodGet:
+		return handler.HandleGetCooldown(ctx, request)
+	case operation == "cooldown" && request.HTTPMethod == http.MethodPut:
+		return handler.HandleSetCooldown(ctx, request)
+	case operation == "tiers" && request.HTTPMethod == http.MethodPut:
+		return handler.HandleSetTier(ctx, request)
+	case operation == "expand" && request.HTTPMethod == http.MethodPost:
+		return handler.HandleExpand(ctx, request)
+	}
+
+	return GetResponse(http.StatusNotFound, "404 Not Found"), fmt.Errorf("unknown admin operation %s %s", request.HTTPMethod, request.Path)
+}
+
+// HandleRequest serves an admin operation with the stores Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init connects the handler to redis and cassandra, only rollbacks and bans need cassandra so the
+// other operations keep working without it
+func Init() error {
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		log.Println("[KEYSPACE] Failed to connect to the keyspace -", err.Error())
+	}
+
+	g_handler = Handler{
+		Board:  store.NewRedisBoardStore(client),
+		Pixels: store.NewCassandraPixelRepository(session, config.GetKeyspace(), config.GetCassandraTables()),
+	}
+
+	return nil
+}
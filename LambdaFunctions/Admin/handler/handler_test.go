@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Common/bans"
+	"Common/store"
+)
+
+const TEST_ADMIN_TOKEN = "test token"
+
+func newRequest(method string, path string, body string) ALBRequest {
+	return ALBRequest{HTTPMethod: method, Path: path, Headers: map[string]string{ADMIN_TOKEN_HEADER: TEST_ADMIN_TOKEN}, Body: body}
+}
+
+func newHandler() Handler {
+	return Handler{Board: store.NewMemoryBoardStore(), Pixels: store.NewMemoryPixelRepository()}
+}
+
+func TestHandleRequestChecksTheToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", TEST_ADMIN_TOKEN)
+	handler := newHandler()
+
+	request := newRequest(http.MethodGet, "/api/admin/bans", "")
+	request.Headers[ADMIN_TOKEN_HEADER] = "wrong token"
+	response, err := handler.HandleRequest(context.Background(), request)
+	if response.StatusCode != http.StatusUnauthorized || err != ErrUnauthorized {
+		t.Fatalf("expected status 401, got %d (%v)", response.StatusCode, err)
+	}
+
+	response, _ = handler.HandleRequest(context.Background(), newRequest(http.MethodGet, "/api/admin/unknown", ""))
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", response.StatusCode)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "")
+	response, _ = handler.HandleRequest(context.Background(), newRequest(http.MethodGet, "/api/admin/bans", ""))
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected every request to be rejected without ADMIN_TOKEN, got %d", response.StatusCode)
+	}
+}
+
+func TestHandleRollback(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", TEST_ADMIN_TOKEN)
+	ctx := context.Background()
+	before := time.Now().Add(-2 * time.Hour)
+	rollbackTo := time.Now().Add(-time.Hour)
+	griefedAt := time.Now().Add(-30 * time.Minute)
+
+	placements := []struct {
+		pixel store.Pixel
+		ts    time.Time
+	}{
+		{store.Pixel{X: 1, Y: 1, Col: 3, User: "alice"}, before},
+		{store.Pixel{X: 1, Y: 1, Col: 5, User: "mallory"}, griefedAt},
+		// no history before the rollback, it is left alone
+		{store.Pixel{X: 2, Y: 1, Col: 4, User: "bob"}, griefedAt},
+		{store.Pixel{X: 3, Y: 1, Col: 6, User: "carol"}, before},
+	}
+
+	tests := []struct {
+		name    string
+		dryRun  bool
+		colors  []uint8 // of 1,1 to 3,1 after the request
+		version uint64
+		owner   string // of 1,1 in the repository after the request
+	}{
+		{"rollback", false, []uint8{3, 4, 6}, 5, ROLLBACK_USER},
+		{"dry run", true, []uint8{5, 4, 6}, 0, "mallory"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newHandler()
+			_, _, metadata, _ := handler.Board.ReadBoard(ctx)
+			for _, placement := range placements {
+				handler.Board.SetPixels(ctx, []store.Pixel{placement.pixel}, metadata)
+				handler.Pixels.Upsert(ctx, placement.pixel, 0, placement.ts)
+			}
+
+			body, _ := json.Marshal(RollbackRequest{X: 1, Y: 1, Width: 3, Height: 1, Timestamp: rollbackTo, DryRun: test.dryRun})
+			response, err := handler.HandleRequest(ctx, newRequest(http.MethodPost, "/api/admin/rollback", string(body)))
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d (%v)", response.StatusCode, err)
+			}
+
+			var rollback RollbackResponse
+			json.Unmarshal([]byte(response.Body), &rollback)
+			expected := RollbackResponse{Pixels: 3, Changed: 1, DryRun: test.dryRun, Version: test.version}
+			if rollback != expected {
+				t.Fatalf("expected %+v, got %+v", expected, rollback)
+			}
+
+			for i, col := range test.colors {
+				pixel, _ := handler.Board.GetPixel(ctx, 1+i, 1)
+				if pixel != col {
+					t.Fatalf("expected color %d at %d,1, got %d", col, 1+i, pixel)
+				}
+			}
+
+			pixel, _ := handler.Pixels.Read(ctx, 1, 1)
+			if pixel.User != test.owner {
+				t.Fatalf("expected 1,1 to be owned by %s in the repository, got %+v", test.owner, pixel)
+			}
+		})
+	}
+}
+
+func TestHandleRollbackRejectsInvalidRectangles(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", TEST_ADMIN_TOKEN)
+	handler := newHandler()
+	rollbackTo := time.Now().Add(-time.Hour)
+
+	for _, rollback := range []RollbackRequest{
+		{X: -1, Y: 0, Width: 10, Height: 10, Timestamp: rollbackTo},
+		{X: 0, Y: 0, Width: 0, Height: 10, Timestamp: rollbackTo},
+		{X: 0, Y: 0, Width: 10000, Height: 10, Timestamp: rollbackTo},
+		{X: 0, Y: 0, Width: 300, Height: 300, Timestamp: rollbackTo},
+		{X: 0, Y: 0, Width: 10, Height: 10},
+		{X: 0, Y: 0, Width: 10, Height: 10, Timestamp: time.Now().Add(time.Hour)},
+	} {
+		body, _ := json.Marshal(rollback)
+		response, _ := handler.HandleRequest(context.Background(), newRequest(http.MethodPost, "/api/admin/rollback", string(body)))
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected %+v to be rejected, got %d", rollback, response.StatusCode)
+		}
+	}
+}
+
+func TestHandleBans(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", TEST_ADMIN_TOKEN)
+	ctx := context.Background()
+	handler := newHandler()
+	pixels := handler.Pixels.(*store.MemoryPixelRepository)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"ban", `{"user": "mallory", "type": "ban", "reason": "griefing"}`, http.StatusOK},
+		{"shadow-ban", `{"user": "eve", "type": "shadow", "expiresAt": "2100-01-01T00:00:00Z"}`, http.StatusOK},
+		{"no user", `{"type": "ban"}`, http.StatusBadRequest},
+		{"unknown type", `{"user": "bob", "type": "mute"}`, http.StatusBadRequest},
+		{"expired", `{"user": "bob", "type": "ban", "expiresAt": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"malformed body", `{"user": `, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		response, _ := handler.HandleRequest(ctx, newRequest(http.MethodPost, "/api/admin/bans", test.body))
+		if response.StatusCode != test.status {
+			t.Fatalf("%s: expected status %d, got %d", test.name, test.status, response.StatusCode)
+		}
+	}
+
+	response, _ := handler.HandleRequest(ctx, newRequest(http.MethodGet, "/api/admin/bans", ""))
+	var listed []bans.Ban
+	json.Unmarshal([]byte(response.Body), &listed)
+	if response.StatusCode != http.StatusOK || len(listed) != 2 || len(pixels.Bans) != 2 {
+		t.Fatalf("expected 2 bans in the board and the repository, got %s and %+v", response.Body, pixels.Bans)
+	}
+
+	request := newRequest(http.MethodDelete, "/api/admin/bans", "")
+	request.QueryStringParameters = map[string]string{"user": "mallory"}
+	response, _ = handler.HandleRequest(ctx, request)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", response.StatusCode)
+	}
+
+	ban, err := handler.Board.GetBan(ctx, "mallory")
+	if err != nil || ban != nil || len(pixels.Bans) != 1 || pixels.Bans[0].User != "eve" {
+		t.Fatalf("expected mallory to be unbanned everywhere, got %+v and %+v (%v)", ban, pixels.Bans, err)
+	}
+
+	response, _ = handler.HandleRequest(ctx, newRequest(http.MethodDelete, "/api/admin/bans", ""))
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unban without user to be rejected, got %d", response.StatusCode)
+	}
+}
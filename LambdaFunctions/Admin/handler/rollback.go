@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"Common/board"
+	"Common/boardimage"
+	"Common/store"
+)
+
+// largest rectangle a single rollback may cover, every pixel costs a history query
+const MAX_ROLLBACK_AREA = 200 * 200
+
+// number of pixel histories read concurrently
+const ROLLBACK_READ_WORKERS = 32
+
+// recorded as the author of rollback writes in the history and placements tables
+const ROLLBACK_USER = "[rollback]"
+
+type RollbackRequest struct {
+	X         int
+	Y         int
+	Width     int
+	Height    int
+	Timestamp time.Time // every pixel is restored to its color at this moment
+	DryRun    bool      // only report what would change
+}
+
+type RollbackResponse struct {
+	Pixels  int    `json:"pixels"`  // pixels in the rectangle
+	Changed int    `json:"changed"` // pixels whose color differs from the one at Timestamp
+	DryRun  bool   `json:"dryRun"`
+	Version uint64 `json:"version,omitempty"` // board version after the rollback
+}
+
+var ErrInvalidRollback = errors.New("invalid rollback rectangle")
+
+func (request *RollbackRequest) Validate(metadata board.Metadata) error {
+	if request.X < 0 || request.Y < 0 || request.Width <= 0 || request.Height <= 0 {
+		return ErrInvalidRollback
+	}
+
+	if request.X+request.Width > metadata.Width || request.Y+request.Height > metadata.Height || request.Width*request.Height > MAX_ROLLBACK_AREA {
+		return ErrInvalidRollback
+	}
+
+	if request.Timestamp.IsZero() || request.Timestamp.After(time.Now()) {
+		return errors.New("rollback timestamp must be in the past")
+	}
+
+	return nil
+}
+
+// FindPixelsToRestore compares every pixel of the rectangle to its color at the requested time and
+// returns those that differ with their color and owner at that time. Pixels without history before
+// that time are skipped rather than painted white.
+func (handler Handler) FindPixelsToRestore(ctx context.Context, request RollbackRequest, bitfield []uint8, metadata board.Metadata) ([]store.Pixel, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	coordinates := make(chan [2]int)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	restores := []store.Pixel{}
+
+	for i := 0; i < ROLLBACK_READ_WORKERS; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for coordinate := range coordinates {
+				x, y := coordinate[0], coordinate[1]
+				// a pixel without history before the timestamp is left alone, its history may
+				// have been lost or the board may have been restored from a snapshot since
+				placement, err := handler.Pixels.ReadAt(ctx, uint16(x), uint16(y), request.Timestamp)
+				if err == store.ErrNotFound {
+					continue
+				}
+
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				} else if err == nil && placement.Col != boardimage.GetPixel(bitfield, y*metadata.Width+x, metadata.BitsPerPixel) {
+					restores = append(restores, store.Pixel{X: uint16(x), Y: uint16(y), Col: placement.Col, User: placement.User})
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for y := request.Y; y < request.Y+request.Height; y++ {
+		for x := request.X; x < request.X+request.Width; x++ {
+			select {
+			case coordinates <- [2]int{x, y}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(coordinates)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+
+	return restores, firstErr
+}
+
+// RecordRollback writes the restored pixels to the keyspace under ROLLBACK_USER with the sequence
+// numbers they were published with, version is the one of the last pixel
+func (handler Handler) RecordRollback(ctx context.Context, restores []store.Pixel, version uint64, ts time.Time) error {
+	firstSeq := version - uint64(len(restores)) + 1
+	for i, restore := range restores {
+		restore.User = ROLLBACK_USER
+		err := handler.Pixels.Upsert(ctx, restore, firstSeq+uint64(i), ts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HandleRollback restores every pixel of a rectangle to its color at a point in time
+func (handler Handler) HandleRollback(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	var rollback RollbackRequest
+	err := DecodeRequestBody(request, &rollback)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	bitfield, _, metadata, err := handler.Board.ReadBoard(ctx)
+	if err != nil {
+		log.Println("[REDIS]: Error reading bitfield", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	err = rollback.Validate(metadata)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	restores, err := handler.FindPixelsToRestore(ctx, rollback, bitfield, metadata)
+	if err != nil {
+		log.Println("[KEYSPACE]: error in reading pixel history", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	response := RollbackResponse{Pixels: rollback.Width * rollback.Height, Changed: len(restores), DryRun: rollback.DryRun}
+	if rollback.DryRun || len(restores) == 0 {
+		return GetJSONResponse(response)
+	}
+
+	// published like any other write so connected clients redraw the pixels, it fails if the board
+	// was expanded or its pixels widened since it was read
+	version, err := handler.Board.SetPixels(ctx, restores, metadata)
+	if err != nil {
+		log.Println("[REDIS]: Error restoring pixels", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+	response.Version = version
+
+	err = handler.RecordRollback(ctx, restores, version, time.Now())
+	if err != nil {
+		log.Println("[KEYSPACE]: error in recording the rollback", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	log.Printf("[ROLLBACK] Restored %d pixels of %dx%d at %d,%d to %s\n", len(restores), rollback.Width, rollback.Height, rollback.X, rollback.Y, rollback.Timestamp.Format(time.RFC3339))
+
+	return GetJSONResponse(response)
+}
@@ -0,0 +1,4 @@
+#!/bin/bash
+GOOS=linux GOARCH=amd64 go build .
+zip Auth.zip Auth sf-class2-root.crt
+aws s3 cp Auth.zip s3://a3-test
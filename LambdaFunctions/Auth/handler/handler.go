@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"Common/bans"
+	"Common/config"
+	"Common/cooldown"
+	"Common/session"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+type Credentials struct {
+	User     string
+	Password string
+}
+
+type SessionResponse struct {
+	User      string    `json:"user"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// bcrypt ignores anything past 72 bytes
+const MIN_PASSWORD_LENGTH = 8
+const MAX_PASSWORD_LENGTH = 72
+
+var g_usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+// every key of the board and the servers starts with it
+const RESERVED_USERNAME_PREFIX = "board"
+
+// the other redis keys, users can't register under them whatever their case so a user name is
+// never mistaken for a key
+var g_reservedUsernames = []string{
+	bans.REDIS_BANS_KEY,
+	cooldown.REDIS_COOLDOWN_POLICY_KEY,
+	strings.TrimSuffix(cooldown.REDIS_USER_TIER_KEY_PREFIX, ":"),
+	strings.TrimSuffix(cooldown.REDIS_COOLDOWN_KEY_PREFIX, ":"),
+}
+
+// Handler registers and logs in users with the stores it is given, Init connects the one behind
+// HandleRequest to redis and cassandra
+type Handler struct {
+	Board store.BoardStore
+	Users store.UserRepository
+}
+
+var g_handler Handler
+var g_sessionSecret []byte = nil
+
+// compared against when the user does not exist so unknown users take as long as wrong passwords
+var g_dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+var ErrReservedUsername = errors.New("reserved username")
+
+func GetBase64DecodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.DecodedLen(len(buffer))
+	decodedBuffer := make([]byte, length)
+	n, _ := base64.StdEncoding.Decode(decodedBuffer, buffer)
+
+	return decodedBuffer[:n]
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+func GetCredentials(request ALBRequest) (*Credentials, error) {
+	var rawRequest []byte = []byte(request.Body)
+	if request.IsBase64Encoded {
+		rawRequest = GetBase64DecodedBuffer([]byte(request.Body))
+	}
+
+	var credentials Credentials
+	err := json.Unmarshal(rawRequest, &credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	if !g_usernamePattern.MatchString(credentials.User) || len(credentials.Password) < MIN_PASSWORD_LENGTH || len(credentials.Password) > MAX_PASSWORD_LENGTH {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &credentials, nil
+}
+
+// IsReservedUsername tells whether user is named like a redis key
+func IsReservedUsername(user string) bool {
+	if strings.HasPrefix(strings.ToLower(user), RESERVED_USERNAME_PREFIX) {
+		return true
+	}
+
+	for _, reserved := range g_reservedUsernames {
+		if strings.EqualFold(user, reserved) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Register stores a new user with a bcrypt hash of the password, fails with store.ErrUserExists
+// if the username is taken and ErrReservedUsername if it is named like a redis key
+func (handler Handler) Register(ctx context.Context, credentials Credentials) error {
+	if IsReservedUsername(credentials.User) {
+		return ErrReservedUsername
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = handler.Users.CreateUser(ctx, credentials.User, string(hash), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// new accounts wait the cooldown of their tier until NEW_ACCOUNT_PERIOD has passed, the user
+	// is registered either way
+	err = handler.Board.SetTier(ctx, credentials.User, cooldown.TIER_NEW, cooldown.NEW_ACCOUNT_PERIOD)
+	if err != nil {
+		log.Println("[REDIS]: Error setting tier of new user", err.Error())
+	}
+
+	return nil
+}
+
+// Login checks the password of a user, fails with ErrInvalidCredentials if the user does not
+// exist or the password is wrong
+func (handler Handler) Login(ctx context.Context, credentials Credentials) error {
+	hash, err := handler.Users.GetPasswordHash(ctx, credentials.User)
+	if err == store.ErrNotFound {
+		bcrypt.CompareHashAndPassword(g_dummyPasswordHash, []byte(credentials.Password))
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		return err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(credentials.Password)) != nil {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func GetSessionResponse(user string) (ALBResponse, error) {
+	token, expiresAt, err := session.IssueToken(g_sessionSecret, user, session.SESSION_TOKEN_LIFETIME)
+	if err != nil {
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	serialized, err := json.Marshal(SessionResponse{User: user, Token: token, ExpiresAt: expiresAt})
+	if err != nil {
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	response := GetResponse(http.StatusOK, "200 OK")
+	response.Body = string(serialized)
+
+	return response, nil
+}
+
+// HandleRequest serves /api/auth/register and /api/auth/login, both take {"User", "Password"}
+// and answer with a session token for the user
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	if request.HTTPMethod != http.MethodPost {
+		return GetResponse(http.StatusMethodNotAllowed, "405 Method Not Allowed"), errors.New("auth requests must be POSTs")
+	}
+
+	credentials, err := GetCredentials(request)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	switch strings.Trim(strings.TrimPrefix(request.Path, "/api/auth"), "/") {
+	case "register":
+		err = handler.Register(ctx, *credentials)
+		if err == ErrReservedUsername {
+			return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+		}
+		if err == store.ErrUserExists {
+			return GetResponse(http.StatusConflict, "409 Conflict"), err
+		}
+	case "login":
+		err = handler.Login(ctx, *credentials)
+		if err == ErrInvalidCredentials {
+			return GetResponse(http.StatusUnauthorized, "401 Unauthorized"), err
+		}
+	default:
+		return GetResponse(http.StatusNotFound, "404 Not Found"), fmt.Errorf("unknown auth operation %s", request.Path)
+	}
+
+	if err != nil {
+		log.Println("[KEYSPACE]: error in reading users", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	return GetSessionResponse(credentials.User)
+}
+
+// HandleRequest serves a registration or a login with the stores Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init reads the secret session tokens are signed with and connects the handler to redis, which
+// holds the tiers of new users, and to the users table in cassandra
+func Init() error {
+	g_sessionSecret = []byte(os.Getenv("SESSION_SECRET"))
+	if len(g_sessionSecret) == 0 {
+		return errors.New("SESSION_SECRET is not set")
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		log.Println("[KEYSPACE] Failed to connect to the keyspace -", err.Error())
+	}
+
+	g_handler = Handler{
+		Board: store.NewRedisBoardStore(client),
+		Users: store.NewCassandraUserRepository(session, config.GetKeyspace(), config.GetCassandraTables()),
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Common/cooldown"
+	"Common/session"
+	"Common/store"
+)
+
+func newRequest(path string, body string) ALBRequest {
+	return ALBRequest{HTTPMethod: http.MethodPost, Path: path, Body: body}
+}
+
+func newHandler(t *testing.T) Handler {
+	g_sessionSecret = []byte("test secret")
+
+	board := store.NewMemoryBoardStore()
+	err := board.SetCooldownPolicy(context.Background(), cooldown.Policy{Default: 60, Tiers: map[string]int64{cooldown.TIER_NEW: 600}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Handler{Board: board, Users: store.NewMemoryUserRepository()}
+}
+
+// getSessionUser checks the response carries a valid session and returns its user
+func getSessionUser(t *testing.T, response ALBResponse) string {
+	var body SessionResponse
+	err := json.Unmarshal([]byte(response.Body), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := session.VerifyToken(g_sessionSecret, body.Token)
+	if err != nil || user != body.User || body.ExpiresAt.Before(time.Now()) {
+		t.Fatalf("expected a valid session of %s, got %q (%v)", body.User, user, err)
+	}
+
+	return user
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	handler := newHandler(t)
+
+	response, err := handler.HandleRequest(ctx, newRequest("/api/auth/register", `{"User": "alice", "Password": "correct horse"}`))
+	if response.StatusCode != http.StatusOK || getSessionUser(t, response) != "alice" {
+		t.Fatalf("expected alice to be registered, got %d (%v)", response.StatusCode, err)
+	}
+
+	// new accounts wait the cooldown of the new tier
+	userCooldown, err := handler.Board.GetCooldown(ctx, "alice")
+	if err != nil || userCooldown != 10*time.Minute {
+		t.Fatalf("expected alice to wait 10m, got %v (%v)", userCooldown, err)
+	}
+
+	hash, err := handler.Users.GetPasswordHash(ctx, "alice")
+	if err != nil || hash == "" || hash == "correct horse" {
+		t.Fatalf("expected a hash of the password to be stored, got %q (%v)", hash, err)
+	}
+
+	response, err = handler.HandleRequest(ctx, newRequest("/api/auth/login", `{"User": "alice", "Password": "correct horse"}`))
+	if response.StatusCode != http.StatusOK || getSessionUser(t, response) != "alice" {
+		t.Fatalf("expected alice to be logged in, got %d (%v)", response.StatusCode, err)
+	}
+}
+
+func TestHandleRequestRejects(t *testing.T) {
+	ctx := context.Background()
+	handler := newHandler(t)
+	handler.Register(ctx, Credentials{User: "alice", Password: "correct horse"})
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"taken username", "/api/auth/register", `{"User": "alice", "Password": "battery staple"}`, http.StatusConflict},
+		{"wrong password", "/api/auth/login", `{"User": "alice", "Password": "battery staple"}`, http.StatusUnauthorized},
+		{"unknown user", "/api/auth/login", `{"User": "bob", "Password": "correct horse"}`, http.StatusUnauthorized},
+		{"short username", "/api/auth/register", `{"User": "al", "Password": "correct horse"}`, http.StatusBadRequest},
+		{"username with a colon", "/api/auth/register", `{"User": "UserTier:alice", "Password": "correct horse"}`, http.StatusBadRequest},
+		{"short password", "/api/auth/register", `{"User": "bob", "Password": "short"}`, http.StatusBadRequest},
+		{"malformed body", "/api/auth/register", `{"User": `, http.StatusBadRequest},
+		{"unknown operation", "/api/auth/logout", `{"User": "alice", "Password": "correct horse"}`, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, _ := handler.HandleRequest(ctx, newRequest(test.path, test.body))
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, response.StatusCode)
+			}
+		})
+	}
+
+	request := newRequest("/api/auth/login", `{"User": "alice", "Password": "correct horse"}`)
+	request.HTTPMethod = http.MethodGet
+	response, _ := handler.HandleRequest(ctx, request)
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", response.StatusCode)
+	}
+}
+
+func TestReservedUsernamesCantRegister(t *testing.T) {
+	ctx := context.Background()
+	handler := newHandler(t)
+
+	reserved := []string{"BoardBitfield", "boardmetadata", "BoardSequence", "BoardSnapshotLock", "Bans", "cooldownpolicy", "UserTier", "Cooldown"}
+	for _, user := range reserved {
+		response, err := handler.HandleRequest(ctx, newRequest("/api/auth/register", `{"User": "`+user+`", "Password": "correct horse"}`))
+		if response.StatusCode != http.StatusBadRequest || err != ErrReservedUsername {
+			t.Fatalf("expected %s to be rejected, got %d (%v)", user, response.StatusCode, err)
+		}
+
+		_, err = handler.Users.GetPasswordHash(ctx, user)
+		if err != store.ErrNotFound {
+			t.Fatalf("expected %s not to be stored, got %v", user, err)
+		}
+	}
+
+	for _, user := range []string{"billboard", "cooldown_fan", "banshee"} {
+		response, err := handler.HandleRequest(ctx, newRequest("/api/auth/register", `{"User": "`+user+`", "Password": "correct horse"}`))
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("expected %s to be registered, got %d (%v)", user, response.StatusCode, err)
+		}
+	}
+}
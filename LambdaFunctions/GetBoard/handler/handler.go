@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"Common/board"
+	"Common/config"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const BOARD_VERSION_HEADER = "X-Board-Version"
+
+// clients and CloudFront reuse a board for a couple of seconds, then revalidate it with its ETag.
+// updates in between reach the clients over the websocket
+const BOARD_CACHE_CONTROL = "public, max-age=2"
+
+type Board struct {
+	Pixels       []uint8 // packed with BitsPerPixel bits per pixel, high bits first
+	Width        uint16
+	Height       uint16
+	BitsPerPixel uint8
+	Version      uint64 // sequence number of the last write included in Pixels
+	X            uint16 // position of Pixels within the board when only a region was requested
+	Y            uint16
+}
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// Handler serves the board of the store it is given, Init connects the one behind HandleRequest
+// to redis
+type Handler struct {
+	Board store.BoardStore
+}
+
+var g_handler Handler
+
+func GetBase64EncodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.EncodedLen(len(buffer))
+	encodedBuffer := make([]byte, length)
+	base64.StdEncoding.Encode(encodedBuffer, buffer)
+
+	return encodedBuffer
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetErrorResponse() ALBResponse {
+	return ALBResponse{StatusCode: http.StatusInternalServerError, StatusDescription: "500 Server Error", Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+// GetETag returns the ETag of a region of the board at version. Every write, rebuild and restore of
+// the board moves it to a new version and expanding or widening it changes its metadata, so a
+// request can be answered with 304 before the pixels are read. It has no commas, If-None-Match
+// separates tags with them.
+func GetETag(version uint64, metadata board.Metadata, region board.Region) string {
+	return fmt.Sprintf(`"%d-%dx%dx%d-%d-%d-%dx%d"`, version, metadata.Width, metadata.Height, metadata.BitsPerPixel, region.X, region.Y, region.Width, region.Height)
+}
+
+// MatchesETag reports whether the If-None-Match header of a request matches etag, weak tags
+// included like any cache would send them
+func MatchesETag(ifNoneMatch string, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HandleRequest returns the whole board, or only the rectangle given by the x, y, w and h query parameters.
+// A request whose If-None-Match holds the ETag of the board it would get is answered with 304.
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	version, metadata, err := handler.Board.GetVersion(ctx)
+	if err != nil {
+		log.Printf("[REDIS] Error reading board version - %s\n", err.Error())
+		return GetErrorResponse(), err
+	}
+
+	region, err := GetRequestedRegion(request.QueryStringParameters, metadata)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	headers := *GetResponseHeaders()
+	headers["Cache-Control"] = BOARD_CACHE_CONTROL
+
+	// the ALB lower-cases header names
+	etag := GetETag(version, metadata, region)
+	if MatchesETag(request.Headers["if-none-match"], etag) {
+		headers[BOARD_VERSION_HEADER] = strconv.FormatUint(version, 10)
+		headers["ETag"] = etag
+		return ALBResponse{StatusCode: http.StatusNotModified, StatusDescription: "304 Not Modified", Headers: headers, IsBase64Encoded: false}, nil
+	}
+
+	var bitfield []uint8
+	if region == metadata.FullRegion() {
+		// the board may have been expanded since the metadata was read
+		bitfield, version, metadata, err = handler.Board.ReadBoard(ctx)
+		region = metadata.FullRegion()
+	} else {
+		bitfield, version, metadata, err = handler.Board.ReadRegion(ctx, region)
+	}
+
+	if err != nil {
+		log.Printf("[REDIS] Error reading board - %s\n", err.Error())
+		return GetErrorResponse(), err
+	}
+
+	body, err := json.Marshal(&Board{Pixels: bitfield, Width: region.Width, Height: region.Height, BitsPerPixel: uint8(metadata.BitsPerPixel), Version: version, X: region.X, Y: region.Y})
+	if err != nil {
+		return GetErrorResponse(), err
+	}
+
+	// the board may have moved on since its version was read
+	headers[BOARD_VERSION_HEADER] = strconv.FormatUint(version, 10)
+	headers["ETag"] = GetETag(version, metadata, region)
+
+	return ALBResponse{StatusCode: http.StatusOK, StatusDescription: "200 OK", Headers: headers, Body: string(GetBase64EncodedBuffer(body)), IsBase64Encoded: true}, nil
+}
+
+// HandleRequest serves the board of the store Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init connects the handler to the redis holding the board
+func Init() error {
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	g_handler = Handler{Board: store.NewRedisBoardStore(client)}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"Common/board"
+	"Common/store"
+)
+
+// unreadBoardStore fails every read of the pixels, a 304 must be answered without them
+type unreadBoardStore struct {
+	*store.MemoryBoardStore
+}
+
+var errPixelsRead = errors.New("pixels read")
+
+func (unreadBoardStore) ReadBoard(ctx context.Context) ([]uint8, uint64, board.Metadata, error) {
+	return nil, 0, board.Metadata{}, errPixelsRead
+}
+
+func (unreadBoardStore) ReadRegion(ctx context.Context, region board.Region) ([]uint8, uint64, board.Metadata, error) {
+	return nil, 0, board.Metadata{}, errPixelsRead
+}
+
+func TestMatchesETag(t *testing.T) {
+	metadata := board.DefaultMetadata()
+	etag := GetETag(7, metadata, metadata.FullRegion())
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		matches     bool
+	}{
+		{"no header", "", false},
+		{"same tag", etag, true},
+		{"weak tag from a cache", "W/" + etag, true},
+		{"one of several tags", `"0123", ` + etag, true},
+		{"any tag", "*", true},
+		{"other version", GetETag(8, metadata, metadata.FullRegion()), false},
+		{"unquoted tag", etag[1 : len(etag)-1], false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if MatchesETag(test.ifNoneMatch, etag) != test.matches {
+				t.Fatalf("expected %q to match %s: %v", test.ifNoneMatch, etag, test.matches)
+			}
+		})
+	}
+}
+
+func TestGetETagTellsBoardsApart(t *testing.T) {
+	metadata := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 4}
+	etags := map[string]string{
+		"board":          GetETag(3, metadata, metadata.FullRegion()),
+		"later version":  GetETag(4, metadata, metadata.FullRegion()),
+		"expanded":       GetETag(3, board.Metadata{Width: 30, Height: 10, BitsPerPixel: 4}, metadata.FullRegion()),
+		"widened":        GetETag(3, board.Metadata{Width: 20, Height: 10, BitsPerPixel: 5}, metadata.FullRegion()),
+		"region":         GetETag(3, metadata, board.Region{X: 0, Y: 0, Width: 10, Height: 10}),
+		"moved region":   GetETag(3, metadata, board.Region{X: 10, Y: 0, Width: 10, Height: 10}),
+		"resized region": GetETag(3, metadata, board.Region{X: 0, Y: 0, Width: 10, Height: 5}),
+	}
+
+	seen := map[string]string{}
+	for name, etag := range etags {
+		if other, ok := seen[etag]; ok {
+			t.Fatalf("expected %s and %s to have different ETags, both got %s", name, other, etag)
+		}
+		seen[etag] = name
+	}
+}
+
+func TestHandleRequest(t *testing.T) {
+	ctx := context.Background()
+	boardStore := store.NewMemoryBoardStore()
+	metadata := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 4}
+	boardStore.WriteBoard(ctx, make([]uint8, metadata.BitfieldSize()), metadata)
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 1, Y: 1, Col: 5}}, metadata)
+	handler := Handler{Board: boardStore}
+
+	response, err := handler.HandleRequest(ctx, ALBRequest{})
+	if err != nil || response.StatusCode != http.StatusOK || !response.IsBase64Encoded {
+		t.Fatalf("expected the board, got %d (%v)", response.StatusCode, err)
+	}
+	etag := response.Headers["ETag"]
+	if etag != GetETag(2, metadata, metadata.FullRegion()) || response.Headers[BOARD_VERSION_HEADER] != "2" || response.Headers["Cache-Control"] != BOARD_CACHE_CONTROL {
+		t.Fatalf("expected the ETag, the version and the cache control of version 2, got %v", response.Headers)
+	}
+
+	body, _ := base64.StdEncoding.DecodeString(response.Body)
+	var served Board
+	err = json.Unmarshal(body, &served)
+	if err != nil || served.Version != 2 || served.Width != 20 || served.Height != 10 || len(served.Pixels) != metadata.BitfieldSize() {
+		t.Fatalf("expected the 20x10 board at version 2, got %+v (%v)", served, err)
+	}
+
+	// revalidated without reading the pixels
+	unread := Handler{Board: unreadBoardStore{boardStore}}
+	response, err = unread.HandleRequest(ctx, ALBRequest{Headers: map[string]string{"if-none-match": etag}})
+	if err != nil || response.StatusCode != http.StatusNotModified || response.Body != "" {
+		t.Fatalf("expected 304 without a body, got %d (%v)", response.StatusCode, err)
+	}
+	if response.Headers["ETag"] != etag || response.Headers["Cache-Control"] != BOARD_CACHE_CONTROL {
+		t.Fatalf("expected the 304 to carry the ETag and the cache control, got %v", response.Headers)
+	}
+
+	// a region has its own ETag
+	region := ALBRequest{QueryStringParameters: map[string]string{"x": "0", "y": "0", "w": "4", "h": "2"}, Headers: map[string]string{"if-none-match": etag}}
+	response, err = handler.HandleRequest(ctx, region)
+	if err != nil || response.StatusCode != http.StatusOK || response.Headers["ETag"] == etag {
+		t.Fatalf("expected the region with an ETag of its own, got %d and %s (%v)", response.StatusCode, response.Headers["ETag"], err)
+	}
+
+	// a write and a rebuild each make the ETag stale
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 2, Y: 1, Col: 6}}, metadata)
+	response, _ = handler.HandleRequest(ctx, ALBRequest{Headers: map[string]string{"if-none-match": etag}})
+	if response.StatusCode != http.StatusOK || response.Headers["ETag"] == etag {
+		t.Fatalf("expected the written board with a new ETag, got %d and %s", response.StatusCode, response.Headers["ETag"])
+	}
+
+	etag = response.Headers["ETag"]
+	boardStore.WriteBoard(ctx, make([]uint8, metadata.BitfieldSize()), metadata)
+	response, _ = handler.HandleRequest(ctx, ALBRequest{Headers: map[string]string{"if-none-match": etag}})
+	if response.StatusCode != http.StatusOK || response.Headers["ETag"] == etag {
+		t.Fatalf("expected the rebuilt board with a new ETag, got %d and %s", response.StatusCode, response.Headers["ETag"])
+	}
+}
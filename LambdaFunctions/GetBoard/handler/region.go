@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"Common/board"
+)
+
+var ErrInvalidRegion = errors.New("invalid board region")
+
+// GetRequestedRegion reads the x, y, w and h query parameters. The whole board is returned
+// when none of them are set.
+func GetRequestedRegion(query map[string]string, metadata board.Metadata) (board.Region, error) {
+	keys := []string{"x", "y", "w", "h"}
+	values := make([]uint16, len(keys))
+
+	present := 0
+	for i, key := range keys {
+		raw, ok := query[key]
+		if !ok {
+			continue
+		}
+
+		value, err := strconv.ParseUint(raw, 10, 16)
+		if err != nil {
+			return board.Region{}, ErrInvalidRegion
+		}
+
+		values[i] = uint16(value)
+		present++
+	}
+
+	if present == 0 {
+		return metadata.FullRegion(), nil
+	}
+
+	if present != len(keys) {
+		return board.Region{}, ErrInvalidRegion
+	}
+
+	region := board.Region{X: values[0], Y: values[1], Width: values[2], Height: values[3]}
+	if !metadata.Contains(region) {
+		return board.Region{}, ErrInvalidRegion
+	}
+
+	return region, nil
+}
@@ -0,0 +1,4 @@
+#!/bin/bash
+GOOS=linux GOARCH=amd64 go build .
+zip GetBoardImage.zip GetBoardImage
+aws s3 cp GetBoardImage.zip s3://a3-test
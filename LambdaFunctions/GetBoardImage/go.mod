@@ -0,0 +1,13 @@
+module GetBoardImage
+
+go 1.19
+
+require (
+	github.com/aws/aws-lambda-go v1.35.0
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
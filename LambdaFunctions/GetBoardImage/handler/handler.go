@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"log"
+	"net/http"
+
+	"Common/boardimage"
+	"Common/config"
+	"Common/palette"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// the ALB rejects lambda responses over 1MB, the png is base64 encoded in the response
+const MAX_IMAGE_SIZE = 1000 * 1000 * 3 / 4
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// Handler renders the board of the store it is given with Palette, Init connects the one behind
+// HandleRequest to redis
+type Handler struct {
+	Board   store.BoardStore
+	Palette color.Palette
+}
+
+var g_handler Handler
+
+func GetBase64EncodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.EncodedLen(len(buffer))
+	encodedBuffer := make([]byte, length)
+	base64.StdEncoding.Encode(encodedBuffer, buffer)
+
+	return encodedBuffer
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+// HandleRequest renders the board as a png, the scale, x, y, w and h query parameters select
+// how much to scale it up and which rectangle to crop
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	bitfield, _, metadata, err := handler.Board.ReadBoard(ctx)
+	if err != nil {
+		log.Printf("[REDIS] Error reading board bitfield - %s\n", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	options, err := boardimage.ParseOptions(request.QueryStringParameters, metadata.Width, metadata.Height)
+	if err != nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), err
+	}
+
+	image, err := boardimage.EncodePNG(bitfield, metadata.Width, metadata.BitsPerPixel, handler.Palette, options)
+	if err != nil {
+		log.Printf("[PNG] Error encoding board image - %s\n", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	if len(image) > MAX_IMAGE_SIZE {
+		return GetResponse(http.StatusRequestEntityTooLarge, "413 Payload Too Large"), fmt.Errorf("board image is %d bytes, use a smaller scale or crop", len(image))
+	}
+
+	headers := *GetResponseHeaders()
+	headers["Content-Type"] = "image/png"
+
+	return ALBResponse{StatusCode: http.StatusOK, StatusDescription: "200 OK", Headers: headers, Body: string(GetBase64EncodedBuffer(image)), IsBase64Encoded: true}, nil
+}
+
+// HandleRequest renders the board of the store Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init parses the palette the board is rendered with and connects the handler to the redis
+// holding the board
+func Init() error {
+	colors, err := palette.Image()
+	if err != nil {
+		return fmt.Errorf("failed to parse the palette - %w", err)
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	g_handler = Handler{Board: store.NewRedisBoardStore(client), Palette: colors}
+
+	return nil
+}
@@ -0,0 +1,4 @@
+#!/bin/bash
+GOOS=linux GOARCH=amd64 go build .
+zip GetPalette.zip GetPalette
+aws s3 cp GetPalette.zip s3://a3-test
@@ -0,0 +1,5 @@
+module GetPalette
+
+go 1.19
+
+require github.com/aws/aws-lambda-go v1.35.0
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"Common/palette"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// serialized once, the palette only changes with a deploy
+var g_paletteResponse []byte = nil
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+// HandleRequest serves /api/palette, the colors pixels can be painted with ordered by color
+// index: [{"name": "white", "hex": "#ffffff"}, ...]
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	if request.HTTPMethod != http.MethodGet {
+		return GetResponse(http.StatusMethodNotAllowed, "405 Method Not Allowed"), errors.New("palette requests must be GETs")
+	}
+
+	response := GetResponse(http.StatusOK, "200 OK")
+	response.Body = string(g_paletteResponse)
+
+	return response, nil
+}
+
+// Init checks and serializes the palette
+func Init() error {
+	_, err := palette.Image()
+	if err != nil {
+		return fmt.Errorf("failed to parse the palette - %w", err)
+	}
+
+	serialized, err := json.Marshal(palette.PALETTE)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the palette - %w", err)
+	}
+
+	g_paletteResponse = serialized
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+
+	"GetPalette/handler"
+
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	err := handler.Init()
+	if err != nil {
+		log.Fatalln("[INIT] Failed to initialize the handler, exiting -", err.Error())
+	}
+}
+
+func main() {
+	lambda.Start(handler.HandleRequest)
+}
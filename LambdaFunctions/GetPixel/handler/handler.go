@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"Common/config"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type Pixel struct {
+	store.Pixel
+	History []store.Placement `json:"history,omitempty"` // most recent first
+}
+
+type ReadRequest struct {
+	X       uint16
+	Y       uint16
+	History int // number of past placements to return along with the pixel
+}
+
+// most placements returned for one pixel
+const MAX_PIXEL_HISTORY = 100
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// Handler serves reads from the repository it is given, Init connects the one behind
+// HandleRequest to cassandra
+type Handler struct {
+	Pixels store.PixelRepository
+}
+
+var g_handler Handler
+
+func GetBase64EncodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.EncodedLen(len(buffer))
+	encodedBuffer := make([]byte, length)
+	base64.StdEncoding.Encode(encodedBuffer, buffer)
+
+	return encodedBuffer
+}
+
+func GetBase64DecodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.DecodedLen(len(buffer))
+	decodedBuffer := make([]byte, length)
+	n, _ := base64.StdEncoding.Decode(decodedBuffer, buffer)
+
+	return decodedBuffer[:n]
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+func GetReadRequest(request ALBRequest) *ReadRequest {
+	var rawRequest []byte = []byte(request.Body)
+	if request.IsBase64Encoded {
+		rawRequest = GetBase64DecodedBuffer([]byte(request.Body))
+	}
+	var readRequest ReadRequest
+	err := json.Unmarshal(rawRequest, &readRequest)
+	if err != nil {
+		log.Println("Error in unmarshalling ALBRequest", err.Error())
+		return nil
+	}
+	return &readRequest
+}
+
+// ReadPixel returns the latest write of the pixel along with its last event.History placements
+func (handler Handler) ReadPixel(ctx context.Context, event ReadRequest) (ALBResponse, error) {
+	pixel, err := handler.Pixels.Read(ctx, event.X, event.Y)
+	if err == store.ErrNotFound {
+		return GetResponse(http.StatusNotFound, "404 Not Found"), fmt.Errorf("pixel %d,%d was never written", event.X, event.Y)
+	}
+	if err != nil {
+		log.Println("[KEYSPACE]: error in reading from database", err)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("cannot find values in Keyspace")
+	}
+
+	fetchedPixel := Pixel{Pixel: pixel}
+	if event.History > 0 {
+		history, err := handler.Pixels.History(ctx, event.X, event.Y, event.History)
+		if err != nil {
+			log.Println("[KEYSPACE]: error in reading pixel history", err)
+			return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("cannot read pixel history")
+		}
+
+		fetchedPixel.History = history
+	}
+
+	serialized, serialerr := json.Marshal(fetchedPixel)
+	if serialerr != nil {
+		log.Println("[KEYSPACE]: error in marshalling pixel", serialerr)
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("cannot marshall fetched pixel")
+	}
+	return ALBResponse{StatusCode: http.StatusOK, StatusDescription: "200 OK", Headers: *GetResponseHeaders(), Body: string(GetBase64EncodedBuffer(serialized)), IsBase64Encoded: true}, nil
+}
+
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	ev := GetReadRequest(request)
+	if ev == nil || ev.History < 0 || ev.History > MAX_PIXEL_HISTORY {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), errors.New("invalid arguments")
+	}
+
+	return handler.ReadPixel(ctx, *ev)
+}
+
+// HandleRequest serves a read with the repository Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init connects the handler to cassandra, reads fail with store.ErrNotConnected when it can't
+func Init() error {
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		log.Println("[KEYSPACE] Failed to connect to the keyspace -", err.Error())
+	}
+
+	g_handler = Handler{Pixels: store.NewCassandraPixelRepository(session, config.GetKeyspace(), config.GetCassandraTables())}
+
+	return nil
+}
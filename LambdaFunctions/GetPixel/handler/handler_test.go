@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"Common/store"
+)
+
+func TestHandleRequest(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	pixels := store.NewMemoryPixelRepository()
+	writes := []store.Pixel{
+		{X: 10, Y: 20, Col: 4, User: "alice"},
+		{X: 10, Y: 20, Col: 2, User: "bob"},
+		{X: 10, Y: 20, Col: 7, User: "carol"},
+		{X: 0, Y: 0, Col: 1, User: "dave"},
+	}
+	for i, pixel := range writes {
+		pixels.Upsert(ctx, pixel, uint64(i+1), start.Add(time.Duration(i)*time.Minute))
+	}
+	handler := Handler{Pixels: pixels}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		pixel  Pixel
+	}{
+		{"latest write", `{"X": 10, "Y": 20}`, http.StatusOK, Pixel{Pixel: writes[2]}},
+		{"with history", `{"X": 10, "Y": 20, "History": 2}`, http.StatusOK, Pixel{Pixel: writes[2], History: []store.Placement{
+			{Col: 7, User: "carol", Timestamp: start.Add(2 * time.Minute)},
+			{Col: 2, User: "bob", Timestamp: start.Add(time.Minute)},
+		}}},
+		{"never written", `{"X": 5, "Y": 5}`, http.StatusNotFound, Pixel{}},
+		{"malformed body", `{"X": 5,`, http.StatusBadRequest, Pixel{}},
+		{"too much history", `{"X": 10, "Y": 20, "History": 101}`, http.StatusBadRequest, Pixel{}},
+		{"negative history", `{"X": 10, "Y": 20, "History": -1}`, http.StatusBadRequest, Pixel{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, _ := handler.HandleRequest(ctx, ALBRequest{HTTPMethod: http.MethodPost, Body: test.body})
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, response.StatusCode)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			body, err := base64.StdEncoding.DecodeString(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var pixel Pixel
+			err = json.Unmarshal(body, &pixel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pixel, test.pixel) {
+				t.Fatalf("expected %+v, got %+v", test.pixel, pixel)
+			}
+		})
+	}
+}
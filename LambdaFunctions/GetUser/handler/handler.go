@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"Common/config"
+	"Common/session"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+type ReadRequest struct {
+	User string // taken from the session token, never from the request body
+}
+
+// UserStatus tells the client when the user of the session token can place its next pixel, the
+// times are those of the redis server the cooldown is measured against
+type UserStatus struct {
+	CanPlace         bool      `json:"canPlace"`
+	SecondsRemaining int64     `json:"secondsRemaining"` // rounded up
+	NextPlacementAt  time.Time `json:"nextPlacementAt"`
+	ServerTime       time.Time `json:"serverTime"`
+}
+
+// Handler serves the cooldown of users with the store it is given, Init connects the one behind
+// HandleRequest to redis
+type Handler struct {
+	Board store.BoardStore
+}
+
+var g_handler Handler
+var g_sessionSecret []byte = nil
+
+func GetBase64DecodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.DecodedLen(len(buffer))
+	decodedBuffer := make([]byte, length)
+	n, _ := base64.StdEncoding.Decode(decodedBuffer, buffer)
+
+	return decodedBuffer[:n]
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+func GetReadRequest(request ALBRequest) *ReadRequest {
+	var rawRequest []byte = []byte(request.Body)
+	if request.IsBase64Encoded {
+		rawRequest = GetBase64DecodedBuffer([]byte(request.Body))
+	}
+	var readRequest ReadRequest
+	err := json.Unmarshal(rawRequest, &readRequest)
+	if err != nil {
+		log.Println("Error in unmarshalling ALBRequest", err.Error())
+		return nil
+	}
+	return &readRequest
+}
+
+// GetUserStatus builds the status of a user that has to wait remaining more at now
+func GetUserStatus(remaining time.Duration, now time.Time) UserStatus {
+	return UserStatus{
+		CanPlace:         remaining <= 0,
+		SecondsRemaining: int64((remaining + time.Second - 1) / time.Second),
+		NextPlacementAt:  now.Add(remaining).UTC(),
+		ServerTime:       now.UTC(),
+	}
+}
+
+// HandleRequest returns when the user of the session token can place its next pixel, see
+// UserStatus. The body is a JSON object, any user in it is ignored.
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	user, err := session.VerifyHeaders(g_sessionSecret, request.Headers)
+	if err != nil {
+		return GetResponse(http.StatusUnauthorized, "401 Unauthorized"), err
+	}
+
+	event := GetReadRequest(request)
+	if event == nil {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), errors.New("invalid arguments")
+	}
+	event.User = user
+
+	// the remaining time follows the current cooldown policy, not the one the pixel was placed under
+	remaining, now, err := handler.Board.GetRemainingCooldown(ctx, event.User)
+	if err != nil {
+		log.Println("[REDIS]: Error getting cooldown of user", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("something wrong" + err.Error())
+	}
+
+	serialized, err := json.Marshal(GetUserStatus(remaining, now))
+	if err != nil {
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), err
+	}
+
+	response := GetResponse(http.StatusOK, "200 OK")
+	response.Body = string(serialized)
+
+	return response, nil
+}
+
+// HandleRequest serves the status of a user with the store Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init reads the secret session tokens are verified with and connects the handler to the redis
+// holding the cooldowns
+func Init() error {
+	g_sessionSecret = []byte(os.Getenv("SESSION_SECRET"))
+	if len(g_sessionSecret) == 0 {
+		return errors.New("SESSION_SECRET is not set")
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	g_handler = Handler{Board: store.NewRedisBoardStore(client)}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Common/cooldown"
+	"Common/session"
+	"Common/store"
+)
+
+func newRequest(t *testing.T, user string, body string) ALBRequest {
+	headers := map[string]string{}
+	if user != "" {
+		token, _, err := session.IssueToken(g_sessionSecret, user, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[session.AUTHORIZATION_HEADER] = "Bearer " + token
+	}
+
+	return ALBRequest{HTTPMethod: http.MethodPost, Headers: headers, Body: body}
+}
+
+func TestHandleRequest(t *testing.T) {
+	g_sessionSecret = []byte("test secret")
+	ctx := context.Background()
+	now := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+	placedAt := now.Add(-88 * time.Second)
+
+	tests := []struct {
+		name   string
+		user   string
+		body   string
+		status int
+		result UserStatus
+	}{
+		{"on cooldown", "alice", `{}`, http.StatusOK, UserStatus{CanPlace: false, SecondsRemaining: 212, NextPlacementAt: now.Add(212 * time.Second), ServerTime: now}},
+		{"user in the body is ignored", "alice", `{"User": "bob"}`, http.StatusOK, UserStatus{CanPlace: false, SecondsRemaining: 212, NextPlacementAt: now.Add(212 * time.Second), ServerTime: now}},
+		{"never placed", "bob", `{}`, http.StatusOK, UserStatus{CanPlace: true, NextPlacementAt: now, ServerTime: now}},
+		{"cooldown of the tier", "carol", `{}`, http.StatusOK, UserStatus{CanPlace: true, NextPlacementAt: now, ServerTime: now}},
+		{"no session", "", `{}`, http.StatusUnauthorized, UserStatus{}},
+		{"malformed body", "alice", `{"User": `, http.StatusBadRequest, UserStatus{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			board := store.NewMemoryBoardStore()
+			board.Now = func() time.Time { return placedAt }
+			board.SetCooldownPolicy(ctx, cooldown.Policy{Default: 300, Tiers: map[string]int64{cooldown.TIER_TRUSTED: 60}})
+			board.SetTier(ctx, "carol", cooldown.TIER_TRUSTED, 0)
+			for i, user := range []string{"alice", "carol"} {
+				board.PlacePixel(ctx, store.PlaceRequest{X: uint16(i), Y: 0, Col: 1, User: user, Cooldown: 5 * time.Minute})
+			}
+			board.Now = func() time.Time { return now }
+
+			handler := Handler{Board: board}
+			response, _ := handler.HandleRequest(ctx, newRequest(t, test.user, test.body))
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, response.StatusCode)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			var status UserStatus
+			err := json.Unmarshal([]byte(response.Body), &status)
+			if err != nil || status != test.result {
+				t.Fatalf("expected %+v, got %s (%v)", test.result, response.Body, err)
+			}
+		})
+	}
+}
+
+func TestGetUserStatusRoundsUp(t *testing.T) {
+	now := time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	status := GetUserStatus(1500*time.Millisecond, now)
+	if status.CanPlace || status.SecondsRemaining != 2 || !status.NextPlacementAt.Equal(now.Add(1500*time.Millisecond)) {
+		t.Fatalf("expected 2 seconds to wait, got %+v", status)
+	}
+
+	status = GetUserStatus(0, now)
+	if !status.CanPlace || status.SecondsRemaining != 0 || !status.NextPlacementAt.Equal(now) {
+		t.Fatalf("expected the user to be able to place, got %+v", status)
+	}
+}
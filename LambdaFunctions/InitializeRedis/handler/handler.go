@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/boardimage"
+	"Common/config"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// Handler rebuilds the board store it is given from the repository, Init connects the one behind
+// HandleRequest to redis and cassandra
+type Handler struct {
+	Board  store.BoardStore
+	Pixels store.PixelRepository
+}
+
+var g_handler Handler
+
+// GetBoardMetadata returns the metadata of the board, a store that lost it gets the BOARD_WIDTH,
+// BOARD_HEIGHT and BOARD_BITS_PER_PIXEL of the environment, which must match any expansion or
+// widening of the board
+func (handler Handler) GetBoardMetadata(ctx context.Context) (board.Metadata, error) {
+	metadata, err := handler.Board.GetMetadata(ctx)
+	if err != store.ErrNotFound {
+		return metadata, err
+	}
+
+	return board.ParseMetadata(map[string]string{
+		board.METADATA_WIDTH_FIELD:          config.GetEnvOrDefault("BOARD_WIDTH", strconv.Itoa(board.DEFAULT_WIDTH)),
+		board.METADATA_HEIGHT_FIELD:         config.GetEnvOrDefault("BOARD_HEIGHT", strconv.Itoa(board.DEFAULT_HEIGHT)),
+		board.METADATA_BITS_PER_PIXEL_FIELD: config.GetEnvOrDefault("BOARD_BITS_PER_PIXEL", strconv.Itoa(board.DEFAULT_BITS_PER_PIXEL)),
+	})
+}
+
+// RebuildReport is the body of a successful rebuild
+type RebuildReport struct {
+	RowsRead       int     `json:"rowsRead"`
+	RowsSkipped    int     `json:"rowsSkipped"` // unreadable, outside of the board or with a color it can't hold
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// BuildBitfield packs the latest write of every pixel in the repository into a fresh bitfield laid
+// out for metadata, counting the rows it read and skipped into report
+func (handler Handler) BuildBitfield(ctx context.Context, metadata board.Metadata, report *RebuildReport) ([]uint8, error) {
+	bitfield := make([]uint8, metadata.BitfieldSize())
+	err := handler.Pixels.Scan(ctx, func(pixel store.Pixel, err error) error {
+		report.RowsRead++
+		if err != nil {
+			log.Println("[KEYSPACE]: Skipping row.", err.Error())
+			report.RowsSkipped++
+			return nil
+		}
+
+		if int(pixel.X) >= metadata.Width || int(pixel.Y) >= metadata.Height {
+			report.RowsSkipped++
+			return nil
+		}
+
+		// colors that don't fit the pixels of the board can't have been placed on it
+		if int(pixel.Col) >= metadata.Colors() {
+			report.RowsSkipped++
+			return nil
+		}
+
+		boardimage.SetPixel(bitfield, int(pixel.X)+metadata.Width*int(pixel.Y), metadata.BitsPerPixel, pixel.Col)
+		return nil
+	})
+
+	return bitfield, err
+}
+
+// RestoreBans copies the unexpired bans mirrored in the repository back into the board store
+func (handler Handler) RestoreBans(ctx context.Context) error {
+	now := time.Now()
+	return handler.Pixels.ScanBans(ctx, func(ban bans.Ban) error {
+		if ban.Expired(now) {
+			return nil
+		}
+
+		return handler.Board.SetBan(ctx, ban)
+	})
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+// HandleRequest rebuilds the bitfield of the board from the repository and swaps it in at once,
+// then restores the bans. The body is a RebuildReport.
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	start := time.Now()
+	metadata, e := handler.GetBoardMetadata(ctx)
+	if e != nil {
+		log.Println("[REDIS]: Error getting board metadata.", e.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error getting board metadata")
+	}
+
+	var report RebuildReport
+	bitfield, e := handler.BuildBitfield(ctx, metadata, &report)
+	if e != nil {
+		log.Println("[KEYSPACE]: Error reading pixels.", e.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error reading pixels")
+	}
+
+	e = handler.Board.WriteBoard(ctx, bitfield, metadata)
+	if e != nil {
+		log.Println("[REDIS]: Error setting in bitfield.", e.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error setting pixel in bitfield")
+	}
+
+	e = handler.RestoreBans(ctx)
+	if e != nil {
+		log.Println("[KEYSPACE]: Error restoring bans.", e.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error restoring bans")
+	}
+
+	report.ElapsedSeconds = time.Since(start).Seconds()
+	log.Printf("[REDIS]: Rebuilt the board from %d rows, skipped %d, in %.3fs\n", report.RowsRead, report.RowsSkipped, report.ElapsedSeconds)
+
+	serialized, e := json.Marshal(report)
+	if e != nil {
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), e
+	}
+
+	response := GetResponse(http.StatusOK, "OK")
+	response.Body = string(serialized)
+
+	return response, nil
+}
+
+// HandleRequest rebuilds the board with the stores Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init connects the handler to the redis it rebuilds and the cassandra it rebuilds it from
+func Init() error {
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		log.Println("[KEYSPACE] Failed to connect to the keyspace -", err.Error())
+	}
+
+	g_handler = Handler{
+		Board:  store.NewRedisBoardStore(client),
+		Pixels: store.NewCassandraPixelRepository(session, config.GetKeyspace(), config.GetCassandraTables()),
+	}
+
+	return nil
+}
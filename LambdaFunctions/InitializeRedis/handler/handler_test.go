@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"Common/bans"
+	"Common/board"
+	"Common/store"
+)
+
+func TestHandleRequest(t *testing.T) {
+	small := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 4}
+
+	tests := []struct {
+		name     string
+		metadata *board.Metadata // already in the board store
+		env      map[string]string
+		expected board.Metadata
+		pixels   map[[2]int]uint8 // expected colors, every other pixel is 0
+		skipped  int
+	}{
+		{
+			name:     "metadata from the environment",
+			env:      map[string]string{"BOARD_WIDTH": "20", "BOARD_HEIGHT": "10", "BOARD_BITS_PER_PIXEL": "4"},
+			expected: small,
+			pixels:   map[[2]int]uint8{{1, 2}: 4, {19, 9}: 15},
+			skipped:  4,
+		},
+		{
+			name:     "metadata already set",
+			metadata: &board.Metadata{Width: 30, Height: 10, BitsPerPixel: 5},
+			env:      map[string]string{"BOARD_WIDTH": "20", "BOARD_HEIGHT": "10", "BOARD_BITS_PER_PIXEL": "4"},
+			expected: board.Metadata{Width: 30, Height: 10, BitsPerPixel: 5},
+			pixels:   map[[2]int]uint8{{1, 2}: 4, {19, 9}: 15, {25, 3}: 2, {4, 4}: 20},
+			skipped:  2,
+		},
+		{
+			name:     "default metadata",
+			expected: board.DefaultMetadata(),
+			pixels:   map[[2]int]uint8{{1, 2}: 4, {19, 9}: 15, {25, 3}: 2, {100, 100}: 7},
+			skipped:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"BOARD_WIDTH", "BOARD_HEIGHT", "BOARD_BITS_PER_PIXEL"} {
+				if value, ok := test.env[key]; ok {
+					t.Setenv(key, value)
+				}
+			}
+
+			ctx := context.Background()
+			boardStore := store.NewMemoryBoardStore()
+			if test.metadata != nil {
+				boardStore.WriteBoard(ctx, make([]uint8, test.metadata.BitfieldSize()), *test.metadata)
+			}
+
+			repository := store.NewMemoryPixelRepository()
+			for _, pixel := range []store.Pixel{
+				{X: 1, Y: 2, Col: 4, User: "alice"},
+				{X: 19, Y: 9, Col: 15, User: "alice"},
+				{X: 25, Y: 3, Col: 2, User: "bob"},      // outside of the small board
+				{X: 4, Y: 4, Col: 20, User: "bob"},      // only fits 5 bits per pixel
+				{X: 100, Y: 100, Col: 7, User: "carol"}, // only on the default board
+			} {
+				repository.Upsert(ctx, pixel, 0, time.Now())
+			}
+			repository.BadRows = 1
+			expiredAt := time.Now().Add(-time.Hour)
+			repository.Bans = []bans.Ban{
+				{User: "bob", Type: bans.BAN_TYPE_BAN},
+				{User: "carol", Type: bans.BAN_TYPE_SHADOW, ExpiresAt: &expiredAt},
+			}
+
+			handler := Handler{Board: boardStore, Pixels: repository}
+			response, err := handler.HandleRequest(ctx, ALBRequest{})
+			if err != nil || response.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %d, got %d (%v)", http.StatusOK, response.StatusCode, err)
+			}
+
+			var report RebuildReport
+			err = json.Unmarshal([]byte(response.Body), &report)
+			if err != nil || report.RowsRead != 6 || report.RowsSkipped != test.skipped {
+				t.Fatalf("expected 6 rows read and %d skipped, got %+v (%v)", test.skipped, report, err)
+			}
+
+			bitfield, _, metadata, err := boardStore.ReadBoard(ctx)
+			if err != nil || metadata != test.expected {
+				t.Fatalf("expected metadata %+v, got %+v (%v)", test.expected, metadata, err)
+			}
+			if len(bitfield) != test.expected.BitfieldSize() {
+				t.Fatalf("expected a bitfield of %d bytes, got %d", test.expected.BitfieldSize(), len(bitfield))
+			}
+
+			for x := 0; x < metadata.Width && x < 128; x++ {
+				for y := 0; y < metadata.Height && y < 128; y++ {
+					col, _ := boardStore.GetPixel(ctx, x, y)
+					if col != test.pixels[[2]int{x, y}] {
+						t.Fatalf("expected color %d at %d,%d, got %d", test.pixels[[2]int{x, y}], x, y, col)
+					}
+				}
+			}
+
+			if ban, _ := boardStore.GetBan(ctx, "bob"); ban == nil {
+				t.Fatal("expected the ban of bob to be restored")
+			}
+			if ban, _ := boardStore.GetBan(ctx, "carol"); ban != nil {
+				t.Fatal("expected the expired ban of carol to be skipped")
+			}
+		})
+	}
+}
+
+func TestRebuildStartsFromAnEmptyBoard(t *testing.T) {
+	t.Setenv("BOARD_WIDTH", "20")
+	t.Setenv("BOARD_HEIGHT", "10")
+	t.Setenv("BOARD_BITS_PER_PIXEL", "4")
+
+	ctx := context.Background()
+	handler := Handler{Board: store.NewMemoryBoardStore(), Pixels: store.NewMemoryPixelRepository()}
+	handler.Pixels.Upsert(ctx, store.Pixel{X: 1, Y: 2, Col: 15, User: "alice"}, 0, time.Now())
+	handler.HandleRequest(ctx, ALBRequest{})
+
+	// a lower color must not be merged with the bits of the previous one
+	handler.Pixels.Upsert(ctx, store.Pixel{X: 1, Y: 2, Col: 2, User: "bob"}, 0, time.Now())
+	response, err := handler.HandleRequest(ctx, ALBRequest{})
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d (%v)", http.StatusOK, response.StatusCode, err)
+	}
+
+	col, err := handler.Board.GetPixel(ctx, 1, 2)
+	if err != nil || col != 2 {
+		t.Fatalf("expected color 2, got %d (%v)", col, err)
+	}
+}
+
+func TestHandleRequestFailsWithoutRepository(t *testing.T) {
+	handler := Handler{Board: store.NewMemoryBoardStore(), Pixels: store.NewCassandraPixelRepository(nil, "rplace", store.CassandraTables{})}
+	response, err := handler.HandleRequest(context.Background(), ALBRequest{})
+	if err == nil || response.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d (%v)", http.StatusInternalServerError, response.StatusCode, err)
+	}
+}
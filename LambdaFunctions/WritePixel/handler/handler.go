@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"Common/bans"
+	"Common/config"
+	"Common/palette"
+	"Common/session"
+	"Common/store"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Color is the index of a color in palette.PALETTE
+type Color uint8
+
+type WriteRequest struct {
+	X    uint16
+	Y    uint16
+	Col  Color
+	User string // taken from the session token, never from the request body
+}
+
+type ALBResponse events.ALBTargetGroupResponse
+type ALBRequest events.ALBTargetGroupRequest
+
+// Handler serves writes with the stores it is given, Init connects the one behind HandleRequest
+// to redis and cassandra
+type Handler struct {
+	Board  store.BoardStore
+	Pixels store.PixelRepository
+}
+
+var g_handler Handler
+var g_sessionSecret []byte = nil
+
+// validateColor checks the color is part of the palette, the script also rejects colors the
+// bits per pixel of the board can't hold
+func validateColor(color Color) bool {
+	return palette.IsColor(int(color))
+}
+
+func GetBase64EncodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.EncodedLen(len(buffer))
+	encodedBuffer := make([]byte, length)
+	base64.StdEncoding.Encode(encodedBuffer, buffer)
+
+	return encodedBuffer
+}
+
+func GetBase64DecodedBuffer(buffer []byte) []byte {
+	length := base64.StdEncoding.DecodedLen(len(buffer))
+	decodedBuffer := make([]byte, length)
+	n, _ := base64.StdEncoding.Decode(decodedBuffer, buffer)
+
+	return decodedBuffer[:n]
+}
+
+func GetResponseHeaders() *map[string]string {
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/json"
+
+	return &headers
+}
+
+func GetResponse(statusCode int, statusDescription string) ALBResponse {
+	return ALBResponse{StatusCode: statusCode, StatusDescription: statusDescription, Headers: *GetResponseHeaders(), IsBase64Encoded: false}
+}
+
+func GetWriteRequest(request ALBRequest) *WriteRequest {
+	var rawRequest []byte = []byte(request.Body)
+	if request.IsBase64Encoded {
+		rawRequest = GetBase64DecodedBuffer([]byte(request.Body))
+	}
+	var writeRequest WriteRequest
+	err := json.Unmarshal(rawRequest, &writeRequest)
+	if err != nil {
+		log.Println("Error in unmarshalling ALBRequest", err.Error())
+		return nil
+	}
+	return &writeRequest
+}
+
+func (handler Handler) HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	user, err := session.VerifyHeaders(g_sessionSecret, request.Headers)
+	if err != nil {
+		return GetResponse(http.StatusUnauthorized, "401 Unauthorized"), err
+	}
+
+	event := GetWriteRequest(request)
+	// error handle for invalid requests, the position is checked against the board metadata by the board store
+	if event == nil || !validateColor(event.Col) {
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), errors.New("invalid arguments")
+	}
+	event.User = user
+
+	ban, err := handler.Board.GetBan(ctx, event.User)
+	if err != nil {
+		log.Println("[REDIS]: Error getting ban of user", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error getting ban of user")
+	}
+	if ban != nil && ban.Type == bans.BAN_TYPE_BAN {
+		return GetResponse(http.StatusForbidden, "403 Forbidden"), errors.New("user is banned")
+	}
+
+	// read on every write so policy changes apply without redeploying
+	userCooldown, err := handler.Board.GetCooldown(ctx, event.User)
+	if err != nil {
+		log.Println("[REDIS]: Error getting cooldown of user", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error getting cooldown of user")
+	}
+
+	result, err := handler.Board.PlacePixel(ctx, store.PlaceRequest{
+		X:        event.X,
+		Y:        event.Y,
+		Col:      uint8(event.Col),
+		User:     event.User,
+		Shadow:   ban != nil && ban.Type == bans.BAN_TYPE_SHADOW,
+		Cooldown: userCooldown,
+	})
+	if err != nil {
+		log.Println("[REDIS]: Error placing pixel.", err.Error())
+		return GetResponse(http.StatusInternalServerError, "500 Internal Error"), errors.New("error placing pixel")
+	}
+
+	switch result.Status {
+	case store.PLACE_RESULT_COOLDOWN:
+		return GetResponse(http.StatusNotAcceptable, "406 Not Acceptable"), fmt.Errorf("minimum time has not passed, %d seconds left", result.SecondsLeft)
+	case store.PLACE_RESULT_INVALID:
+		return GetResponse(http.StatusBadRequest, "400 Bad Request"), errors.New("invalid arguments")
+	}
+
+	// writes of shadow-banned users never reached the board
+	if result.Seq == 0 {
+		return GetResponse(http.StatusOK, "OK"), nil
+	}
+
+	// the pixel is on the board already, a failed write to cassandra is only logged
+	err = handler.Pixels.Upsert(ctx, store.Pixel{X: event.X, Y: event.Y, Col: uint8(event.Col), User: event.User}, result.Seq, time.Now())
+	if err != nil {
+		log.Println("[KEYSPACE]:", err.Error())
+	}
+
+	return GetResponse(http.StatusOK, "OK"), nil
+}
+
+// HandleRequest serves a write with the stores Init connected to
+func HandleRequest(ctx context.Context, request ALBRequest) (ALBResponse, error) {
+	return g_handler.HandleRequest(ctx, request)
+}
+
+// Init reads the secret session tokens are verified with and connects the handler to redis and
+// cassandra, writes are still accepted while cassandra is unreachable
+func Init() error {
+	g_sessionSecret = []byte(os.Getenv("SESSION_SECRET"))
+	if len(g_sessionSecret) == 0 {
+		return errors.New("SESSION_SECRET is not set")
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		return err
+	}
+	log.Println("[REDIS] Connected to redis")
+
+	// writes still reach redis without cassandra
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		log.Println("[KEYSPACE] Failed to connect to the keyspace -", err.Error())
+	}
+
+	g_handler = Handler{
+		Board:  store.NewRedisBoardStore(client),
+		Pixels: store.NewCassandraPixelRepository(session, config.GetKeyspace(), config.GetCassandraTables()),
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"Common/bans"
+	"Common/session"
+	"Common/store"
+)
+
+func newRequest(t *testing.T, user string, body string) ALBRequest {
+	headers := map[string]string{}
+	if user != "" {
+		token, _, err := session.IssueToken(g_sessionSecret, user, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[session.AUTHORIZATION_HEADER] = "Bearer " + token
+	}
+
+	return ALBRequest{HTTPMethod: http.MethodPost, Headers: headers, Body: body}
+}
+
+func TestHandleRequest(t *testing.T) {
+	g_sessionSecret = []byte("test secret")
+
+	tests := []struct {
+		name   string
+		user   string
+		body   string
+		status int
+		pixel  *store.Pixel // expected in the board and the repository after the write
+	}{
+		{"placed", "alice", `{"X": 10, "Y": 20, "Col": 4}`, http.StatusOK, &store.Pixel{X: 10, Y: 20, Col: 4, User: "alice"}},
+		{"user in the body is ignored", "alice", `{"X": 10, "Y": 20, "Col": 4, "User": "mallory"}`, http.StatusOK, &store.Pixel{X: 10, Y: 20, Col: 4, User: "alice"}},
+		{"no session", "", `{"X": 10, "Y": 20, "Col": 4}`, http.StatusUnauthorized, nil},
+		{"malformed body", "alice", `{"X": 10,`, http.StatusBadRequest, nil},
+		{"color outside of the palette", "alice", `{"X": 10, "Y": 20, "Col": 16}`, http.StatusBadRequest, nil},
+		{"outside of the board", "alice", `{"X": 1000, "Y": 20, "Col": 4}`, http.StatusBadRequest, nil},
+		{"on cooldown", "carol", `{"X": 10, "Y": 20, "Col": 4}`, http.StatusNotAcceptable, nil},
+		{"banned", "bob", `{"X": 10, "Y": 20, "Col": 4}`, http.StatusForbidden, nil},
+		{"shadow-banned", "mallory", `{"X": 10, "Y": 20, "Col": 4}`, http.StatusOK, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			handler := Handler{Board: store.NewMemoryBoardStore(), Pixels: store.NewMemoryPixelRepository()}
+			handler.Board.SetBan(ctx, bans.Ban{User: "bob", Type: bans.BAN_TYPE_BAN})
+			handler.Board.SetBan(ctx, bans.Ban{User: "mallory", Type: bans.BAN_TYPE_SHADOW})
+			handler.Board.PlacePixel(ctx, store.PlaceRequest{X: 0, Y: 0, Col: 1, User: "carol", Cooldown: time.Minute})
+
+			response, _ := handler.HandleRequest(ctx, newRequest(t, test.user, test.body))
+			if response.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, response.StatusCode)
+			}
+
+			if test.pixel == nil {
+				col, _ := handler.Board.GetPixel(ctx, 10, 20)
+				_, err := handler.Pixels.Read(ctx, 10, 20)
+				if col != 0 || err != store.ErrNotFound {
+					t.Fatalf("expected the pixel to be untouched, got color %d in the board (%v)", col, err)
+				}
+				return
+			}
+
+			col, err := handler.Board.GetPixel(ctx, int(test.pixel.X), int(test.pixel.Y))
+			if err != nil || col != test.pixel.Col {
+				t.Fatalf("expected color %d in the board, got %d (%v)", test.pixel.Col, col, err)
+			}
+
+			pixel, err := handler.Pixels.Read(ctx, test.pixel.X, test.pixel.Y)
+			if err != nil || pixel != *test.pixel {
+				t.Fatalf("expected %+v in the repository, got %+v (%v)", *test.pixel, pixel, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"image/color"
+	"log"
+
+	"Common/palette"
+	"Common/store"
+	getboardimage "GetBoardImage/handler"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var g_palette color.Palette = nil
+
+func Palette_Init() {
+	colors, err := palette.Image()
+	if err != nil {
+		log.Fatalln("[PALETTE] Failed to parse the palette - ", err.Error())
+	}
+
+	g_palette = colors
+}
+
+// HandleBoardImage renders the board of the redis the server is connected to with the GetBoardImage
+// lambda handler, see it for the query parameters
+func HandleBoardImage(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	handler := getboardimage.Handler{Board: store.NewRedisBoardStore(g_redisClient), Palette: g_palette}
+
+	response, err := handler.HandleRequest(ctx, getboardimage.ALBRequest(request))
+	return events.ALBTargetGroupResponse(response), err
+}
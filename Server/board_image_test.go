@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Common/board"
+	"Common/store"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestHandleBoardImage(t *testing.T) {
+	ctx := context.Background()
+	redisServer := miniredis.RunT(t)
+	g_redisClient = redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { g_redisClient.Close() })
+
+	boardStore := store.NewRedisBoardStore(g_redisClient)
+	metadata := board.Metadata{Width: 20, Height: 10, BitsPerPixel: 4}
+	boardStore.WriteBoard(ctx, make([]uint8, metadata.BitfieldSize()), metadata)
+	boardStore.SetPixels(ctx, []store.Pixel{{X: 3, Y: 2, Col: 5}}, metadata)
+
+	handler := ServeLambda("GetBoardImage", HandleBoardImage)
+
+	response := httptest.NewRecorder()
+	handler(response, httptest.NewRequest(http.MethodGet, "/api/board.png?scale=2&x=2&y=2&w=4&h=3", nil))
+	if response.Code != http.StatusOK || response.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a png, got %d (%s)", response.Code, response.Body)
+	}
+
+	image, err := png.Decode(bytes.NewReader(response.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := image.Bounds().Size(); size.X != 8 || size.Y != 6 {
+		t.Fatalf("expected the 4x3 crop scaled to 8x6, got %v", size)
+	}
+	if image.At(2, 0) != g_palette[5] || image.At(0, 0) != g_palette[0] {
+		t.Fatalf("expected the pixel at 3,2 in color 5, got %v", image.At(2, 0))
+	}
+
+	response = httptest.NewRecorder()
+	handler(response, httptest.NewRequest(http.MethodGet, "/api/board.png?w=100", nil))
+	if response.Code != http.StatusBadRequest {
+		t.Fatalf("expected a crop outside of the board to be rejected, got %d", response.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+// the board is split into square chunks, clients only receive updates for the chunks they subscribe to
+const BOARD_CHUNK_SIZE = 50
+
+// most chunks a single client can be subscribed to at once
+const CLIENT_MAX_CHUNK_SUBSCRIPTIONS = 1024
+
+type ChunkID uint32 // cx: uint16(ChunkID), cy: ChunkID >> 16
+
+const (
+	REQUEST_TYPE_SUBSCRIBE   = "subscribe"
+	REQUEST_TYPE_UNSUBSCRIBE = "unsubscribe"
+)
+
+// ClientRequest is a message sent by the browser over the websocket, other than the keepalive ping
+type ClientRequest struct {
+	Type   string      `json:"type"`
+	Chunks [][2]uint16 `json:"chunks"` // [cx, cy] pairs
+}
+
+func GetChunkID(cx uint16, cy uint16) ChunkID {
+	return ChunkID(uint32(cy)<<16 | uint32(cx))
+}
+
+func GetPixelChunk(pixel *Pixel) ChunkID {
+	var x uint16 = uint16(pixel.Pos)
+	var y uint16 = uint16(pixel.Pos >> 16)
+
+	return GetChunkID(x/BOARD_CHUNK_SIZE, y/BOARD_CHUNK_SIZE)
+}
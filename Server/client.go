@@ -1,32 +1,228 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type Client struct {
-	connection    *websocket.Conn
-	LastWriteTime int64
+	connection *websocket.Conn
+	User       string // username the client connected as, may be empty
+
+	sendQueue chan []byte   // drained by WritePump, the only goroutine allowed to write to connection
+	done      chan struct{} // closed once the client is disconnected
+	closeOnce sync.Once
+
+	holdLock    sync.Mutex
+	holding     bool              // live messages are buffered in held while a replay is being prepared
+	held        []OutgoingMessage // live messages received while holding
+	replayedSeq uint64            // live messages at or below this sequence number were already replayed
+
+	chunks map[ChunkID]struct{} // chunks the client subscribed to, nil until it subscribes to any, guarded by the service
 }
 
-const CLIENT_WRITE_DELAY = time.Minute * 5
+// OutgoingMessage is a serialized message for a client along with the sequence number
+// of the board update it carries, 0 for messages that are not board updates
+type OutgoingMessage struct {
+	Seq  uint64
+	Data []byte
+}
+
+// time allowed to write a message to the client
+const CLIENT_WRITE_WAIT = 10 * time.Second
+
+// time allowed between two reads from the client before it is considered disconnected
+const CLIENT_READ_WAIT = 60 * time.Second
+
+// websocket pings are sent at this period, must be less than CLIENT_READ_WAIT
+const CLIENT_PING_PERIOD = (CLIENT_READ_WAIT * 9) / 10
+
+// largest message accepted from the client
+const CLIENT_MAX_MESSAGE_SIZE = 4096
+
+// application level keepalive sent by the browser (see api.js)
+const CLIENT_PING_MESSAGE = "ping"
+
+// number of messages that can be waiting for a client before it is considered too slow and evicted
+const CLIENT_SEND_QUEUE_SIZE = 1024
+
+func NewClient(connection *websocket.Conn, user string) *Client {
+	return &Client{
+		connection: connection,
+		User:       user,
+		sendQueue:  make(chan []byte, CLIENT_SEND_QUEUE_SIZE),
+		done:       make(chan struct{}),
+	}
+}
 
-// TODO: detect disconnection
-func (client *Client) Send(messageID int, message []byte) bool {
-	err := client.connection.WriteMessage(messageID, message)
-	if err != nil {
-		log.Printf("Error sending message to client - %s", err.Error())
+func (client *Client) push(message []byte) bool {
+	select {
+	case client.sendQueue <- message:
+		return true
+	default:
 		return false
 	}
+}
+
+// Enqueue queues a message for the client without blocking, returns false if the queue is full
+func (client *Client) Enqueue(message OutgoingMessage) bool {
+	client.holdLock.Lock()
+	defer client.holdLock.Unlock()
+
+	if client.holding {
+		if len(client.held) >= CLIENT_SEND_QUEUE_SIZE {
+			return false
+		}
+
+		client.held = append(client.held, message)
+		return true
+	}
+
+	if message.Seq != 0 && message.Seq <= client.replayedSeq {
+		return true
+	}
+
+	return client.push(message.Data)
+}
+
+// Hold buffers live messages until Release is called
+func (client *Client) Hold() {
+	client.holdLock.Lock()
+	defer client.holdLock.Unlock()
+
+	client.holding = true
+}
+
+// Release queues the replayed messages followed by the live messages held since Hold that
+// were not part of the replay, returns false if they don't fit in the queue
+func (client *Client) Release(replay []OutgoingMessage) bool {
+	client.holdLock.Lock()
+	defer client.holdLock.Unlock()
+
+	client.holding = false
+	held := client.held
+	client.held = nil
+
+	for _, message := range replay {
+		if !client.push(message.Data) {
+			return false
+		}
+
+		if message.Seq > client.replayedSeq {
+			client.replayedSeq = message.Seq
+		}
+	}
+
+	for _, message := range held {
+		if message.Seq != 0 && message.Seq <= client.replayedSeq {
+			continue
+		}
+
+		if !client.push(message.Data) {
+			return false
+		}
+	}
 
 	return true
 }
 
-func (client *Client) Run() {
+// ResetSequence forgets the updates replayed to the client, the board sequence started over
+func (client *Client) ResetSequence() {
+	client.holdLock.Lock()
+	defer client.holdLock.Unlock()
+
+	client.replayedSeq = 0
+}
+
+// Close disconnects the client, it is safe to call more than once
+func (client *Client) Close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+		client.connection.Close()
+	})
+}
+
+// WritePump writes queued messages to the connection in order until the client is closed,
+// it also pings the client periodically so dead connections are detected by ReadPump
+func (client *Client) WritePump(service *ClientMessageService) {
+	ticker := time.NewTicker(CLIENT_PING_PERIOD)
+	defer func() {
+		ticker.Stop()
+		service.UnregisterClient(client)
+		client.Close()
+	}()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case message := <-client.sendQueue:
+			client.connection.SetWriteDeadline(time.Now().Add(CLIENT_WRITE_WAIT))
+			err := client.connection.WriteMessage(websocket.TextMessage, message)
+			if err != nil {
+				log.Printf("Error sending message to client - %s", err.Error())
+				return
+			}
+		case <-ticker.C:
+			client.connection.SetWriteDeadline(time.Now().Add(CLIENT_WRITE_WAIT))
+			err := client.connection.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				log.Printf("Error pinging client - %s", err.Error())
+				return
+			}
+		}
+	}
+}
+
+func (client *Client) ExtendReadDeadline() error {
+	return client.connection.SetReadDeadline(time.Now().Add(CLIENT_READ_WAIT))
+}
+
+// ReadPump reads from the connection until it closes or the client stops responding,
+// then unregisters the client
+func (client *Client) ReadPump(service *ClientMessageService) {
+	defer func() {
+		service.UnregisterClient(client)
+		client.Close()
+	}()
+
+	client.connection.SetReadLimit(CLIENT_MAX_MESSAGE_SIZE)
+	client.ExtendReadDeadline()
+	client.connection.SetPongHandler(func(string) error {
+		return client.ExtendReadDeadline()
+	})
+
 	for {
-		// client.connection.PI
+		messageType, message, err := client.connection.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				log.Printf("Client disconnected unexpectedly - %s", err.Error())
+			}
+			return
+		}
+
+		// any message proves the client is still alive
+		client.ExtendReadDeadline()
+
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		if string(message) == CLIENT_PING_MESSAGE {
+			continue
+		}
+
+		var request ClientRequest
+		err = json.Unmarshal(message, &request)
+		if err != nil {
+			log.Printf("Ignoring unexpected message from client - %q", message)
+			continue
+		}
+
+		service.HandleClientRequest(client, &request)
 	}
 }
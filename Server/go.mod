@@ -2,10 +2,15 @@ module Server
 
 go 1.19
 
-require github.com/gorilla/websocket v1.5.0
+require (
+	github.com/alicebob/miniredis/v2 v2.30.0
+	github.com/gorilla/websocket v1.5.0
+)
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/go-redis/redis/v9 v9.0.0-rc.1 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64 // indirect
 )
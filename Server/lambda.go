@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ALBHandler is the shape every lambda handler is adapted to so that it can be
+// served over plain net/http by the server
+type ALBHandler func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error)
+
+// BuildALBRequest converts an incoming http request into the event the ALB
+// would have handed to the lambda for the same request
+func BuildALBRequest(request *http.Request) (events.ALBTargetGroupRequest, error) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return events.ALBTargetGroupRequest{}, err
+	}
+
+	event := events.ALBTargetGroupRequest{
+		HTTPMethod:            request.Method,
+		Path:                  request.URL.Path,
+		QueryStringParameters: make(map[string]string),
+		Headers:               make(map[string]string),
+		RequestContext:        events.ALBTargetGroupRequestContext{ELB: events.ELBContext{TargetGroupArn: "standalone"}},
+	}
+
+	for key, values := range request.URL.Query() {
+		event.QueryStringParameters[key] = values[0]
+	}
+
+	// the ALB lower-cases header names before invoking the target
+	for key, values := range request.Header {
+		event.Headers[strings.ToLower(key)] = values[0]
+	}
+
+	if utf8.Valid(body) {
+		event.Body = string(body)
+	} else {
+		event.Body = base64.StdEncoding.EncodeToString(body)
+		event.IsBase64Encoded = true
+	}
+
+	return event, nil
+}
+
+// WriteALBResponse writes a lambda response back to the http client the same
+// way the ALB would
+func WriteALBResponse(response http.ResponseWriter, albResponse events.ALBTargetGroupResponse) {
+	body := []byte(albResponse.Body)
+	if albResponse.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(albResponse.Body)
+		if err != nil {
+			log.Printf("[LAMBDA] Failed to decode base64 response body - %s\n", err.Error())
+			response.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body = decoded
+	}
+
+	for key, value := range albResponse.Headers {
+		response.Header().Set(key, value)
+	}
+
+	for key, values := range albResponse.MultiValueHeaders {
+		for _, value := range values {
+			response.Header().Add(key, value)
+		}
+	}
+
+	statusCode := albResponse.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	response.WriteHeader(statusCode)
+	response.Write(body)
+}
+
+// ServeLambda mounts a lambda handler as a net/http handler
+func ServeLambda(name string, handler ALBHandler) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		event, err := BuildALBRequest(request)
+		if err != nil {
+			log.Printf("[LAMBDA] Failed to read request body for %s - %s\n", name, err.Error())
+			response.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		albResponse, err := handler(request.Context(), event)
+		if err != nil {
+			log.Printf("[LAMBDA] %s returned an error - %s\n", name, err.Error())
+
+			// a lambda that errors without building a response is surfaced by the ALB as a 502
+			if albResponse.StatusCode == 0 {
+				response.WriteHeader(http.StatusBadGateway)
+				return
+			}
+		}
+
+		WriteALBResponse(response, albResponse)
+	}
+}
@@ -1,78 +1,87 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+
+	"Common/session"
 
 	"github.com/gorilla/websocket"
 )
 
+// Color is the index of a color in palette.PALETTE
 type Color uint8
 
-const COLOR_MASK = 0b0000_1111
-
-const (
-	WHITE       Color = iota
-	BLACK       Color = iota
-	BLUE        Color = iota
-	GREEN       Color = iota
-	RED         Color = iota
-	ORANGE      Color = iota
-	YELLOW      Color = iota
-	BROWN       Color = iota
-	PURPLE      Color = iota
-	PINK        Color = iota
-	LIGHTGREEN  Color = iota
-	LIGHTBLUE   Color = iota
-	LIGHTRED    Color = iota
-	LIGHTYELLOW Color = iota
-	MAROON      Color = iota
-	VIOLET      Color = iota
-)
-
-var colorMap = map[Color]string{
-	WHITE:       "#ffffff",
-	BLACK:       "#000000",
-	BLUE:        "#2450a4",
-	GREEN:       "#00a368",
-	RED:         "#be0039",
-	ORANGE:      "#ffa800",
-	YELLOW:      "#FFFF00",
-	BROWN:       "#6d482f",
-	PURPLE:      "#811e9f",
-	PINK:        "#b44ac0",
-	LIGHTGREEN:  "#7eed56",
-	LIGHTBLUE:   "#3690ea",
-	LIGHTRED:    "#be0049",
-	LIGHTYELLOW: "ffd631",
-	MAROON:      "#6d001a",
-	VIOLET:      "#e4abff",
-}
-
 type Pixel struct {
 	Pos  uint32 // x: uint16(Pos & uint16(1)), y: Pos >> 16
 	Col  Color
 	User string // owner's username
+	Seq  uint64 // position of this write in the update stream
+
+	// set for writes of shadow-banned users, only echoed to the user's own sockets
+	Shadow bool `json:",omitempty"`
 }
 
+var g_standalone = flag.Bool("standalone", false, "also serve the /api lambda routes (build with -tags standalone)")
+var g_staticDir = flag.String("static", "", "directory of client files to serve at / in standalone mode")
+
 var g_WSConnUpgrader = websocket.Upgrader{CheckOrigin: CheckWSConnectionOrigin}
 var g_clientMessageService *ClientMessageService = nil // initialized in main
+var g_sessionSecret []byte = nil
 
 func CheckWSConnectionOrigin(_ *http.Request) bool {
 	return true
 }
 
+// GetRequestUser returns the user of the session token passed in the token query parameter, since
+// browsers can't set headers on websocket requests, or in the Authorization header. Connections
+// without a token are anonymous and get an empty user.
+func GetRequestUser(request *http.Request) (string, error) {
+	token := request.URL.Query().Get("token")
+	if token == "" {
+		token = session.GetBearerToken(request.Header.Get("Authorization"))
+	}
+
+	if token == "" || len(g_sessionSecret) == 0 {
+		return "", nil
+	}
+
+	return session.VerifyToken(g_sessionSecret, token)
+}
+
 func HandleNewConnection(response http.ResponseWriter, request *http.Request) {
+	// the user lets writes of a shadow-banned user be echoed to that user's sockets only
+	user, err := GetRequestUser(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	ws, err := g_WSConnUpgrader.Upgrade(response, request, nil)
 	if err != nil {
 		log.Printf("Error upgrading client to websocket client - %s", err.Error())
 		return
 	}
 
-	client := Client{connection: ws, LastWriteTime: 0}
-	g_clientMessageService.RegisterClient(&client)
-	go client.Run()
+	client := NewClient(ws, user)
+
+	// a client reconnecting with ?since=<seq> is sent the updates it missed before any live traffic
+	since, err := strconv.ParseUint(request.URL.Query().Get("since"), 10, 64)
+	resume := err == nil
+	if resume {
+		client.Hold()
+	}
+
+	g_clientMessageService.RegisterClient(client)
+	go client.WritePump(g_clientMessageService)
+	go client.ReadPump(g_clientMessageService)
+
+	if resume {
+		go g_clientMessageService.ResumeClient(client, since)
+	}
 }
 
 func HandleHealthCheck(response http.ResponseWriter, request *http.Request) {
@@ -81,15 +90,34 @@ func HandleHealthCheck(response http.ResponseWriter, request *http.Request) {
 
 func init() {
 	g_clientMessageService = NewClientMessageService()
+	Palette_Init()
+
+	g_sessionSecret = []byte(os.Getenv("SESSION_SECRET"))
+	if len(g_sessionSecret) == 0 {
+		log.Println("[AUTH] SESSION_SECRET is not set, every websocket connection will be anonymous")
+	}
 }
 
 func main() {
+	flag.Parse()
+
 	http.HandleFunc("/ws", HandleNewConnection)
 	http.HandleFunc("/healthcheck", HandleHealthCheck)
+	http.HandleFunc("/api/board.png", ServeLambda("GetBoardImage", HandleBoardImage))
+	http.HandleFunc("/api/snapshots", HandleSnapshots)
+
+	if *g_standalone {
+		Standalone_Init(http.DefaultServeMux)
+
+		if *g_staticDir != "" {
+			http.Handle("/", http.FileServer(http.Dir(*g_staticDir)))
+		}
+	}
 
 	updateChannel := make(chan *Pixel)
 	Redis_Init(os.Getenv("REDIS_ENDPOINT"), os.Getenv("REDIS_PORT"), updateChannel)
 	go g_clientMessageService.Run(updateChannel)
+	Snapshot_Init()
 
 	err := http.ListenAndServe(":8000", nil)
 	if err != nil {
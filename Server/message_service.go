@@ -2,30 +2,54 @@ package main
 
 import (
 	"container/list"
+	"context"
 	"encoding/json"
 	"log"
 	"sync"
-
-	"github.com/gorilla/websocket"
+	"sync/atomic"
 )
 
 type ClientMessageService struct {
 	clients        *list.List
 	clientTable    map[*Client]*list.Element
 	clientListLock sync.Mutex
+
+	// every registered client is in exactly one of these, guarded by clientListLock
+	chunkSubscribers  map[ChunkID]map[*Client]struct{}
+	wholeBoardClients map[*Client]struct{} // clients that never subscribed to a chunk get every update
+
+	userClients map[string]map[*Client]struct{} // clients by username, guarded by clientListLock
+
+	droppedMessages uint64 // messages that could not be queued for a client
+	evictedClients  uint64 // clients disconnected for not keeping up with their queue
 }
 
 type Message struct {
-	X     int32 `json:"x"`
-	Y     int32 `json:"y"`
-	Color Color `json:"color"`
+	X     int32  `json:"x"`
+	Y     int32  `json:"y"`
+	Color Color  `json:"color"`
+	Seq   uint64 `json:"seq"` // board version produced by this update
 }
 
+// ControlMessage tells the client to do something other than draw a pixel
+type ControlMessage struct {
+	Type string `json:"type"`
+}
+
+// sent when the updates a client asked to resume from can't be replayed, it should refetch the whole board
+const MESSAGE_TYPE_RESYNC = "resync"
+
+// most updates replayed to a resuming client before it is told to resync instead
+const CLIENT_REPLAY_LIMIT = CLIENT_SEND_QUEUE_SIZE / 2
+
 func NewClientMessageService() *ClientMessageService {
 	return &ClientMessageService{
-		clients:        list.New().Init(),
-		clientTable:    make(map[*Client]*list.Element),
-		clientListLock: sync.Mutex{}}
+		clients:           list.New().Init(),
+		clientTable:       make(map[*Client]*list.Element),
+		clientListLock:    sync.Mutex{},
+		chunkSubscribers:  make(map[ChunkID]map[*Client]struct{}),
+		wholeBoardClients: make(map[*Client]struct{}),
+		userClients:       make(map[string]map[*Client]struct{})}
 }
 
 func (service *ClientMessageService) RegisterClient(client *Client) {
@@ -34,6 +58,17 @@ func (service *ClientMessageService) RegisterClient(client *Client) {
 
 	el := service.clients.PushBack(client)
 	service.clientTable[client] = el
+	service.wholeBoardClients[client] = struct{}{}
+
+	if client.User != "" {
+		userClients, ok := service.userClients[client.User]
+		if !ok {
+			userClients = make(map[*Client]struct{})
+			service.userClients[client.User] = userClients
+		}
+
+		userClients[client] = struct{}{}
+	}
 }
 
 func (service *ClientMessageService) UnregisterClient(client *Client) {
@@ -50,6 +85,191 @@ func (service *ClientMessageService) UnregisterClient(client *Client) {
 	}
 
 	service.clients.Remove(el)
+	delete(service.clientTable, client)
+	delete(service.wholeBoardClients, client)
+
+	for chunk := range client.chunks {
+		service.removeChunkSubscriber(chunk, client)
+	}
+	client.chunks = nil
+
+	if userClients, ok := service.userClients[client.User]; ok {
+		delete(userClients, client)
+		if len(userClients) == 0 {
+			delete(service.userClients, client.User)
+		}
+	}
+}
+
+// must be called with clientListLock held
+func (service *ClientMessageService) removeChunkSubscriber(chunk ChunkID, client *Client) {
+	subscribers := service.chunkSubscribers[chunk]
+	delete(subscribers, client)
+	if len(subscribers) == 0 {
+		delete(service.chunkSubscribers, chunk)
+	}
+}
+
+// SubscribeClient limits the updates a client receives to the given chunks and any it
+// subscribed to before
+func (service *ClientMessageService) SubscribeClient(client *Client, chunks []ChunkID) {
+	service.clientListLock.Lock()
+	defer service.clientListLock.Unlock()
+
+	if _, ok := service.clientTable[client]; !ok {
+		return
+	}
+
+	if client.chunks == nil {
+		client.chunks = make(map[ChunkID]struct{})
+		delete(service.wholeBoardClients, client)
+	}
+
+	for _, chunk := range chunks {
+		if len(client.chunks) >= CLIENT_MAX_CHUNK_SUBSCRIPTIONS {
+			log.Printf("[CMS] Client reached the limit of %d chunk subscriptions\n", CLIENT_MAX_CHUNK_SUBSCRIPTIONS)
+			return
+		}
+
+		subscribers, ok := service.chunkSubscribers[chunk]
+		if !ok {
+			subscribers = make(map[*Client]struct{})
+			service.chunkSubscribers[chunk] = subscribers
+		}
+
+		subscribers[client] = struct{}{}
+		client.chunks[chunk] = struct{}{}
+	}
+}
+
+// UnsubscribeClient stops sending updates for the given chunks to a client
+func (service *ClientMessageService) UnsubscribeClient(client *Client, chunks []ChunkID) {
+	service.clientListLock.Lock()
+	defer service.clientListLock.Unlock()
+
+	for _, chunk := range chunks {
+		if _, ok := client.chunks[chunk]; !ok {
+			continue
+		}
+
+		delete(client.chunks, chunk)
+		service.removeChunkSubscriber(chunk, client)
+	}
+}
+
+func (service *ClientMessageService) HandleClientRequest(client *Client, request *ClientRequest) {
+	chunks := make([]ChunkID, 0, len(request.Chunks))
+	for _, chunk := range request.Chunks {
+		chunks = append(chunks, GetChunkID(chunk[0], chunk[1]))
+	}
+
+	switch request.Type {
+	case REQUEST_TYPE_SUBSCRIBE:
+		service.SubscribeClient(client, chunks)
+	case REQUEST_TYPE_UNSUBSCRIBE:
+		service.UnsubscribeClient(client, chunks)
+	default:
+		log.Printf("[CMS] Ignoring client request of unknown type %q\n", request.Type)
+	}
+}
+
+// EvictClient disconnects a client whose send queue overflowed
+func (service *ClientMessageService) EvictClient(client *Client) {
+	service.UnregisterClient(client)
+	client.Close()
+
+	// the message that overflowed plus everything still waiting in the queue is lost
+	dropped := atomic.AddUint64(&service.droppedMessages, uint64(1+len(client.sendQueue)))
+	evicted := atomic.AddUint64(&service.evictedClients, 1)
+	log.Printf("[CMS] Evicted slow client (%d clients evicted, %d messages dropped in total)\n", evicted, dropped)
+}
+
+func (service *ClientMessageService) DroppedMessages() uint64 {
+	return atomic.LoadUint64(&service.droppedMessages)
+}
+
+func (service *ClientMessageService) EvictedClients() uint64 {
+	return atomic.LoadUint64(&service.evictedClients)
+}
+
+// Broadcast queues a message for every registered client, evicting the ones that can't keep up
+func (service *ClientMessageService) Broadcast(msg OutgoingMessage) {
+	var slowClients []*Client
+
+	service.clientListLock.Lock()
+	for el := service.clients.Front(); el != nil; el = el.Next() {
+		client := el.Value.(*Client)
+		if !client.Enqueue(msg) {
+			slowClients = append(slowClients, client)
+		}
+	}
+	service.clientListLock.Unlock()
+
+	for _, client := range slowClients {
+		service.EvictClient(client)
+	}
+}
+
+// BroadcastToChunk queues a board update for the clients subscribed to its chunk and the ones
+// watching the whole board, evicting the ones that can't keep up
+func (service *ClientMessageService) BroadcastToChunk(chunk ChunkID, msg OutgoingMessage) {
+	var slowClients []*Client
+
+	service.clientListLock.Lock()
+	for client := range service.chunkSubscribers[chunk] {
+		if !client.Enqueue(msg) {
+			slowClients = append(slowClients, client)
+		}
+	}
+
+	for client := range service.wholeBoardClients {
+		if !client.Enqueue(msg) {
+			slowClients = append(slowClients, client)
+		}
+	}
+	service.clientListLock.Unlock()
+
+	for _, client := range slowClients {
+		service.EvictClient(client)
+	}
+}
+
+// SendToUser queues a message for every client of a user, evicting the ones that can't keep up
+func (service *ClientMessageService) SendToUser(user string, msg OutgoingMessage) {
+	var slowClients []*Client
+
+	service.clientListLock.Lock()
+	for client := range service.userClients[user] {
+		if !client.Enqueue(msg) {
+			slowClients = append(slowClients, client)
+		}
+	}
+	service.clientListLock.Unlock()
+
+	for _, client := range slowClients {
+		service.EvictClient(client)
+	}
+}
+
+// ResyncClients tells every registered client to refetch the board after the sequence was reset,
+// updates they already replayed past are sent again since they belong to the new sequence
+func (service *ClientMessageService) ResyncClients() {
+	var slowClients []*Client
+
+	msg := service.BuildResyncMessage()
+	service.clientListLock.Lock()
+	for el := service.clients.Front(); el != nil; el = el.Next() {
+		client := el.Value.(*Client)
+		client.ResetSequence()
+		if !client.Enqueue(msg) {
+			slowClients = append(slowClients, client)
+		}
+	}
+	service.clientListLock.Unlock()
+
+	for _, client := range slowClients {
+		service.EvictClient(client)
+	}
 }
 
 func (service *ClientMessageService) BuildMessageFromPixel(pixel *Pixel) *Message {
@@ -60,15 +280,62 @@ func (service *ClientMessageService) BuildMessageFromPixel(pixel *Pixel) *Messag
 		X:     int32(x),
 		Y:     int32(y),
 		Color: pixel.Col,
+		Seq:   pixel.Seq,
 	}
 
 	return &msg
 }
 
+func (service *ClientMessageService) BuildResyncMessage() OutgoingMessage {
+	msg, _ := json.Marshal(&ControlMessage{Type: MESSAGE_TYPE_RESYNC})
+	return OutgoingMessage{Seq: 0, Data: msg}
+}
+
+// ResumeClient replays the updates after since to a client that is holding live messages,
+// or tells it to resync if they are no longer available
+func (service *ClientMessageService) ResumeClient(client *Client, since uint64) {
+	var replay []OutgoingMessage
+
+	pixels, err := Redis_ReadUpdatesSince(context.Background(), since)
+	if err != nil || len(pixels) > CLIENT_REPLAY_LIMIT {
+		if err != nil && err != ErrReplayGap {
+			log.Printf("[CMS] Error reading updates to replay - %s\n", err.Error())
+		}
+
+		replay = append(replay, service.BuildResyncMessage())
+	} else {
+		for _, pixel := range pixels {
+			msg, err := json.Marshal(service.BuildMessageFromPixel(pixel))
+			if err != nil {
+				log.Printf("[CMS] Error marshaling message, this message will not be replayed - %s\n", err.Error())
+				continue
+			}
+
+			replay = append(replay, OutgoingMessage{Seq: pixel.Seq, Data: msg})
+		}
+	}
+
+	if !client.Release(replay) {
+		service.EvictClient(client)
+	}
+}
+
 func (service *ClientMessageService) Run(msgChannel <-chan *Pixel) {
+	var lastSeq uint64
+
 	for {
 		pixel := <-msgChannel
 
+		// the sequence went back, redis lost the board and it was rebuilt or restored, clients
+		// would take the updates for ones their board already has
+		if pixel.Seq != 0 && pixel.Seq <= lastSeq {
+			log.Printf("[CMS] Board sequence went back from %d to %d, telling every client to resync\n", lastSeq, pixel.Seq)
+			service.ResyncClients()
+		}
+		if pixel.Seq != 0 {
+			lastSeq = pixel.Seq
+		}
+
 		msgStruct := service.BuildMessageFromPixel(pixel)
 		msg, err := json.Marshal(msgStruct)
 		if err != nil {
@@ -76,12 +343,12 @@ func (service *ClientMessageService) Run(msgChannel <-chan *Pixel) {
 			continue
 		}
 
-		service.clientListLock.Lock()
-		for el := service.clients.Front(); el != nil; el = el.Next() {
-			client := el.Value.(*Client)
-			go client.Send(websocket.TextMessage, msg)
+		// writes of shadow-banned users never reached the board, only their author sees them
+		if pixel.Shadow {
+			service.SendToUser(pixel.User, OutgoingMessage{Seq: 0, Data: msg})
+			continue
 		}
 
-		service.clientListLock.Unlock()
+		service.BroadcastToChunk(GetPixelChunk(pixel), OutgoingMessage{Seq: pixel.Seq, Data: msg})
 	}
 }
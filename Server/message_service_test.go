@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"Common/session"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/gorilla/websocket"
+)
+
+// time allowed for a message to reach a test client or for the service to catch up
+const TEST_WAIT = 2 * time.Second
+
+// setupServer serves /ws with a fresh message service fed by the returned channel, the replay
+// log is read from miniredis
+func setupServer(t *testing.T) (*httptest.Server, *miniredis.Miniredis, chan<- *Pixel) {
+	redisServer := miniredis.RunT(t)
+	g_redisClient = redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { g_redisClient.Close() })
+
+	g_clientMessageService = NewClientMessageService()
+	updates := make(chan *Pixel)
+	go g_clientMessageService.Run(updates)
+
+	server := httptest.NewServer(http.HandlerFunc(HandleNewConnection))
+	t.Cleanup(server.Close)
+
+	return server, redisServer, updates
+}
+
+// connect opens a websocket to the server and waits until the service registered it
+func connect(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	registered := countClients()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	connection, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connection.Close() })
+
+	waitFor(t, "the client to be registered", func() bool { return countClients() == registered+1 })
+	return connection
+}
+
+func countClients() int {
+	g_clientMessageService.clientListLock.Lock()
+	defer g_clientMessageService.clientListLock.Unlock()
+
+	return len(g_clientMessageService.clientTable)
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(TEST_WAIT)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// readMessages reads count board updates or control messages from the connection
+func readMessages(t *testing.T, connection *websocket.Conn, count int) []string {
+	messages := []string{}
+	connection.SetReadDeadline(time.Now().Add(TEST_WAIT))
+	for len(messages) < count {
+		_, message, err := connection.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected %d messages, got %v (%v)", count, messages, err)
+		}
+		messages = append(messages, string(message))
+	}
+
+	return messages
+}
+
+// expectNoMessage fails if anything but a close reaches the connection within a short while
+func expectNoMessage(t *testing.T, connection *websocket.Conn) {
+	connection.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, message, err := connection.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected no message, got %s", message)
+	}
+}
+
+func pixelMessage(x int32, y int32, col Color, seq uint64) string {
+	serialized, _ := json.Marshal(Message{X: x, Y: y, Color: col, Seq: seq})
+	return string(serialized)
+}
+
+func newPixel(x uint32, y uint32, col Color, seq uint64) *Pixel {
+	return &Pixel{Pos: y<<16 | x, Col: col, User: "alice", Seq: seq}
+}
+
+func subscribe(t *testing.T, connection *websocket.Conn, chunks ...[2]uint16) {
+	err := connection.WriteJSON(ClientRequest{Type: REQUEST_TYPE_SUBSCRIBE, Chunks: chunks})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribedClientsOnlyGetTheirChunks(t *testing.T) {
+	server, _, updates := setupServer(t)
+
+	whole := connect(t, server, "")
+	subscribed := connect(t, server, "")
+	subscribe(t, subscribed, [2]uint16{1, 0})
+	waitFor(t, "the subscription", func() bool {
+		g_clientMessageService.clientListLock.Lock()
+		defer g_clientMessageService.clientListLock.Unlock()
+		return len(g_clientMessageService.chunkSubscribers[GetChunkID(1, 0)]) == 1
+	})
+
+	updates <- newPixel(10, 10, 3, 1)                  // chunk 0,0
+	updates <- newPixel(BOARD_CHUNK_SIZE+5, 10, 4, 2)  // chunk 1,0
+	updates <- newPixel(10, BOARD_CHUNK_SIZE+5, 5, 3)  // chunk 0,1
+	updates <- newPixel(2*BOARD_CHUNK_SIZE-1, 0, 6, 4) // chunk 1,0
+
+	messages := readMessages(t, subscribed, 2)
+	if messages[0] != pixelMessage(BOARD_CHUNK_SIZE+5, 10, 4, 2) || messages[1] != pixelMessage(2*BOARD_CHUNK_SIZE-1, 0, 6, 4) {
+		t.Fatalf("expected only the updates of chunk 1,0, got %v", messages)
+	}
+	expectNoMessage(t, subscribed)
+
+	messages = readMessages(t, whole, 4)
+	if messages[0] != pixelMessage(10, 10, 3, 1) || messages[2] != pixelMessage(10, BOARD_CHUNK_SIZE+5, 5, 3) {
+		t.Fatalf("expected every update on the client without subscriptions, got %v", messages)
+	}
+
+	// shadowed writes only reach the sockets of their author, whatever chunks they subscribed to
+	g_sessionSecret = []byte("test secret")
+	token, _, _ := session.IssueToken(g_sessionSecret, "mallory", time.Hour)
+	mallory := connect(t, server, "token="+token)
+	malloryElsewhere := connect(t, server, "token="+token)
+	subscribe(t, malloryElsewhere, [2]uint16{1, 1})
+
+	updates <- &Pixel{Pos: 10, Col: 7, User: "mallory", Shadow: true}
+	for _, connection := range []*websocket.Conn{mallory, malloryElsewhere} {
+		messages := readMessages(t, connection, 1)
+		if messages[0] != pixelMessage(10, 0, 7, 0) {
+			t.Fatalf("expected the shadowed write to be echoed to mallory without a sequence number, got %v", messages)
+		}
+	}
+	expectNoMessage(t, whole)
+	expectNoMessage(t, subscribed)
+}
+
+func TestUpdatesAreDeliveredInOrder(t *testing.T) {
+	server, _, updates := setupServer(t)
+	connection := connect(t, server, "")
+
+	const count = 500
+	go func() {
+		for seq := uint64(1); seq <= count; seq++ {
+			updates <- newPixel(uint32(seq%100), uint32(seq/100), Color(seq%16), seq)
+		}
+	}()
+
+	for seq, message := range readMessages(t, connection, count) {
+		var update Message
+		err := json.Unmarshal([]byte(message), &update)
+		if err != nil || update.Seq != uint64(seq+1) {
+			t.Fatalf("expected update %d, got %s (%v)", seq+1, message, err)
+		}
+	}
+}
+
+func TestSlowClientsAreEvicted(t *testing.T) {
+	g_clientMessageService = NewClientMessageService()
+
+	// a client nothing drains the send queue of, like one whose socket stopped accepting writes
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		ws, err := g_WSConnUpgrader.Upgrade(response, request, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		g_clientMessageService.RegisterClient(NewClient(ws, ""))
+	}))
+	t.Cleanup(server.Close)
+
+	connection, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	waitFor(t, "the client to be registered", func() bool { return countClients() == 1 })
+
+	message := OutgoingMessage{Seq: 1, Data: []byte(pixelMessage(0, 0, 1, 1))}
+	for i := 0; i < CLIENT_SEND_QUEUE_SIZE; i++ {
+		g_clientMessageService.BroadcastToChunk(GetChunkID(0, 0), message)
+	}
+	if g_clientMessageService.EvictedClients() != 0 || countClients() != 1 {
+		t.Fatal("expected a full queue not to evict the client yet")
+	}
+
+	g_clientMessageService.BroadcastToChunk(GetChunkID(0, 0), message)
+	if g_clientMessageService.EvictedClients() != 1 || countClients() != 0 {
+		t.Fatalf("expected the client to be evicted, %d clients evicted and %d registered", g_clientMessageService.EvictedClients(), countClients())
+	}
+	if dropped := g_clientMessageService.DroppedMessages(); dropped != CLIENT_SEND_QUEUE_SIZE+1 {
+		t.Fatalf("expected %d dropped messages, got %d", CLIENT_SEND_QUEUE_SIZE+1, dropped)
+	}
+
+	// the connection of the evicted client is closed
+	connection.SetReadDeadline(time.Now().Add(TEST_WAIT))
+	_, _, err = connection.ReadMessage()
+	if netErr, ok := err.(net.Error); err == nil || ok && netErr.Timeout() {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestResumingClientsGetTheUpdatesTheyMissed(t *testing.T) {
+	server, redisServer, updates := setupServer(t)
+
+	// updates 3 to 5 are still in the replay log
+	for seq := uint64(3); seq <= 5; seq++ {
+		serialized, _ := json.Marshal(newPixel(uint32(seq), 0, Color(seq), seq))
+		redisServer.ZAdd(REDIS_UPDATE_LOG_KEY, float64(seq), string(serialized))
+	}
+	redisServer.Set(REDIS_SEQUENCE_KEY, "5")
+
+	resumed := connect(t, server, "since=3")
+
+	// a live update that was already replayed is not sent twice
+	updates <- newPixel(5, 0, 5, 5)
+	updates <- newPixel(6, 0, 6, 6)
+
+	messages := readMessages(t, resumed, 3)
+	expected := []string{pixelMessage(4, 0, 4, 4), pixelMessage(5, 0, 5, 5), pixelMessage(6, 0, 6, 6)}
+	if fmt.Sprint(messages) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, messages)
+	}
+	expectNoMessage(t, resumed)
+
+	resync, _ := json.Marshal(ControlMessage{Type: MESSAGE_TYPE_RESYNC})
+	for _, query := range []string{"since=1", "since=10"} {
+		connection := connect(t, server, query)
+		messages := readMessages(t, connection, 1)
+		if messages[0] != string(resync) {
+			t.Fatalf("expected a client resuming with %s to be told to resync, got %v", query, messages)
+		}
+	}
+
+	redisServer.Set(REDIS_SEQUENCE_KEY, "6")
+	upToDate := connect(t, server, "since=6")
+	updates <- newPixel(7, 0, 7, 7)
+	messages = readMessages(t, upToDate, 1)
+	if messages[0] != pixelMessage(7, 0, 7, 7) {
+		t.Fatalf("expected the live update only, got %v", messages)
+	}
+}
+
+func TestClientsResyncWhenTheSequenceGoesBack(t *testing.T) {
+	server, redisServer, updates := setupServer(t)
+
+	for seq := uint64(3); seq <= 5; seq++ {
+		serialized, _ := json.Marshal(newPixel(uint32(seq), 0, Color(seq), seq))
+		redisServer.ZAdd(REDIS_UPDATE_LOG_KEY, float64(seq), string(serialized))
+	}
+	redisServer.Set(REDIS_SEQUENCE_KEY, "5")
+
+	whole := connect(t, server, "")
+	resumed := connect(t, server, "since=3")
+	readMessages(t, resumed, 2)
+
+	// redis lost the board and the sequence, the rebuilt board starts over below what clients saw
+	updates <- newPixel(6, 0, 6, 6)
+	updates <- newPixel(1, 0, 1, 2)
+
+	resync, _ := json.Marshal(ControlMessage{Type: MESSAGE_TYPE_RESYNC})
+	expected := fmt.Sprint([]string{string(resync), pixelMessage(1, 0, 1, 2)})
+	if messages := readMessages(t, resumed, 3); fmt.Sprint(messages[1:]) != expected {
+		t.Fatalf("expected the resumed client to resync and get the update of the new sequence, got %v", messages)
+	}
+	if messages := readMessages(t, whole, 3); fmt.Sprint(messages[1:]) != expected {
+		t.Fatalf("expected the connected client to resync and get the update of the new sequence, got %v", messages)
+	}
+}
+
+func TestResumingClientsResyncOnAHoleInTheReplayLog(t *testing.T) {
+	server, redisServer, _ := setupServer(t)
+
+	for _, seq := range []uint64{3, 4, 6} {
+		serialized, _ := json.Marshal(newPixel(uint32(seq), 0, Color(seq), seq))
+		redisServer.ZAdd(REDIS_UPDATE_LOG_KEY, float64(seq), string(serialized))
+	}
+	redisServer.Set(REDIS_SEQUENCE_KEY, "7")
+
+	resync, _ := json.Marshal(ControlMessage{Type: MESSAGE_TYPE_RESYNC})
+	for _, query := range []string{"since=3", "since=5"} {
+		connection := connect(t, server, query)
+		messages := readMessages(t, connection, 1)
+		if messages[0] != string(resync) {
+			t.Fatalf("expected a client resuming with %s to be told to resync, got %v", query, messages)
+		}
+	}
+}
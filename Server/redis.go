@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -10,11 +11,19 @@ import (
 	"github.com/go-redis/redis/v9"
 )
 
-const BOARD_UPDATE_CHANNEL = "BoardUpdate"
+const BOARD_UPDATE_STREAM = "BoardUpdateStream"
+const BOARD_UPDATE_STREAM_FIELD = "pixel"
+const BOARD_UPDATE_READ_COUNT = 100
+const BOARD_UPDATE_READ_BLOCK = 5 * time.Second
+const REDIS_RECONNECT_DELAY = 2 * time.Second
+const REDIS_SEQUENCE_KEY = "BoardSequence"
+const REDIS_UPDATE_LOG_KEY = "BoardUpdateLog" // sorted set of published pixels scored by sequence number
 const REDIS_CONNECTION_RETRIES = 3
 
 var g_redisClient *redis.Client = nil
 
+var ErrReplayGap = errors.New("updates are no longer in the replay log")
+
 func Redis_InitClientInternal(addr string, port string) *redis.Client {
 	client := redis.NewClient(&redis.Options{Addr: fmt.Sprintf("%s:%s", addr, port)})
 
@@ -42,23 +51,126 @@ func Redis_InitClientInternal(addr string, port string) *redis.Client {
 func Redis_Init(addr string, port string, clientUpdateChannel chan<- *Pixel) {
 	g_redisClient = Redis_InitClientInternal(addr, port)
 
-	pubsub := g_redisClient.Subscribe(context.Background(), BOARD_UPDATE_CHANNEL)
-	go Redis_WatchBoardUpdates(pubsub.Channel(), clientUpdateChannel)
+	lastID, err := Redis_GetLastStreamID(context.Background())
+	if err != nil {
+		log.Fatalln("[REDIS] Failed to read the tail of the board update stream - ", err.Error())
+	}
+
+	go Redis_WatchBoardUpdates(lastID, clientUpdateChannel)
 
 	log.Println("[REDIS] Connected to redis")
 }
 
-func Redis_WatchBoardUpdates(messageChannel <-chan *redis.Message, clientUpdateChannel chan<- *Pixel) {
-	for msg := range messageChannel {
-		payload := []byte(msg.Payload)
+// Redis_GetLastStreamID returns the id of the newest entry in the board update stream, so
+// only updates added after the server started are consumed
+func Redis_GetLastStreamID(ctx context.Context) (string, error) {
+	entries, err := g_redisClient.XRevRangeN(ctx, BOARD_UPDATE_STREAM, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+
+	return entries[0].ID, nil
+}
+
+// Redis_WatchBoardUpdates consumes the board update stream after lastID forever. The id of the
+// last consumed entry is tracked so nothing added while the connection is down is missed.
+func Redis_WatchBoardUpdates(lastID string, clientUpdateChannel chan<- *Pixel) {
+	for {
+		streams, err := g_redisClient.XRead(context.Background(), &redis.XReadArgs{
+			Streams: []string{BOARD_UPDATE_STREAM, lastID},
+			Count:   BOARD_UPDATE_READ_COUNT,
+			Block:   BOARD_UPDATE_READ_BLOCK,
+		}).Result()
+
+		if err == redis.Nil {
+			continue
+		}
+
+		if err != nil {
+			log.Printf("[REDIS] Failed to read board update stream after %s, retrying - %s\n", lastID, err.Error())
+			time.Sleep(REDIS_RECONNECT_DELAY)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastID = msg.ID
+
+				payload, ok := msg.Values[BOARD_UPDATE_STREAM_FIELD].(string)
+				if !ok {
+					log.Printf("[REDIS] Board update %s has no %s field\n", msg.ID, BOARD_UPDATE_STREAM_FIELD)
+					continue
+				}
+
+				var pixel Pixel
+				err := json.Unmarshal([]byte(payload), &pixel)
+				if err != nil {
+					log.Printf("[REDIS] Failed to deserailize board update %s - %s\n", msg.ID, err.Error())
+					continue
+				}
+
+				clientUpdateChannel <- &pixel
+			}
+		}
+	}
+}
+
+// Redis_ReadUpdatesSince returns the updates published after since in sequence order, or
+// ErrReplayGap if some of them are missing from the replay log
+func Redis_ReadUpdatesSince(ctx context.Context, since uint64) ([]*Pixel, error) {
+	current, err := g_redisClient.Get(ctx, REDIS_SEQUENCE_KEY).Uint64()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if since == current {
+		return nil, nil
+	}
+
+	// the client is ahead of the board, the sequence was reset
+	if since > current {
+		return nil, ErrReplayGap
+	}
+
+	oldest, err := g_redisClient.ZRangeWithScores(ctx, REDIS_UPDATE_LOG_KEY, 0, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(oldest) == 0 || uint64(oldest[0].Score) > since+1 {
+		return nil, ErrReplayGap
+	}
+
+	entries, err := g_redisClient.ZRangeByScore(ctx, REDIS_UPDATE_LOG_KEY, &redis.ZRangeBy{Min: fmt.Sprintf("(%d", since), Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
 
+	pixels := make([]*Pixel, 0, len(entries))
+	for _, entry := range entries {
 		var pixel Pixel
-		err := json.Unmarshal(payload, &pixel)
+		err := json.Unmarshal([]byte(entry), &pixel)
 		if err != nil {
-			log.Printf("[REDIS] Failed to deserailize pubsub message - %s\n", err.Error())
+			log.Printf("[REDIS] Failed to deserailize replayed update - %s\n", err.Error())
 			continue
 		}
 
-		clientUpdateChannel <- &pixel
+		// a hole in the log means an update was never logged or got trimmed meanwhile
+		if pixel.Seq != since+uint64(len(pixels))+1 {
+			return nil, ErrReplayGap
+		}
+
+		pixels = append(pixels, &pixel)
 	}
+
+	// the newest updates are missing from the log
+	if since+uint64(len(pixels)) < current {
+		return nil, ErrReplayGap
+	}
+
+	return pixels, nil
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"Common/snapshot"
+)
+
+const ADMIN_TOKEN_HEADER = "x-admin-token"
+
+// held by the server taking the snapshot of the current interval so the other servers skip it
+const SNAPSHOT_LOCK_KEY = "BoardSnapshotLock"
+const DEFAULT_SNAPSHOT_INTERVAL = 10 * time.Minute
+const DEFAULT_SNAPSHOT_KEEP = 144 // a day of snapshots every 10 minutes
+const SNAPSHOT_TIMEOUT = time.Minute
+
+var g_snapshotBlobs snapshot.BlobStore = nil // nil when snapshots are disabled
+var g_snapshotRetention snapshot.Retention
+
+// Snapshot_Init starts taking a snapshot of the board every SNAPSHOT_INTERVAL into the blob store
+// of SNAPSHOT_BUCKET or SNAPSHOT_DIR, see snapshot.NewBlobStoreFromEnv. Must be called after
+// Redis_Init.
+func Snapshot_Init() {
+	blobs, err := snapshot.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalln("[SNAPSHOT] Failed to open the snapshot store -", err.Error())
+	}
+	if blobs == nil {
+		log.Println("[SNAPSHOT] Neither SNAPSHOT_BUCKET nor SNAPSHOT_DIR is set, snapshots are disabled")
+		return
+	}
+	g_snapshotBlobs = blobs
+
+	interval := DEFAULT_SNAPSHOT_INTERVAL
+	if value, ok := os.LookupEnv("SNAPSHOT_INTERVAL"); ok {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalln("[SNAPSHOT] SNAPSHOT_INTERVAL must be a duration like 10m -", err.Error())
+		}
+	}
+
+	g_snapshotRetention.Keep = DEFAULT_SNAPSHOT_KEEP
+	if value, ok := os.LookupEnv("SNAPSHOT_KEEP"); ok {
+		g_snapshotRetention.Keep, err = strconv.Atoi(value)
+		if err != nil || g_snapshotRetention.Keep < 0 {
+			log.Fatalln("[SNAPSHOT] SNAPSHOT_KEEP must be a number of snapshots, 0 keeps every one")
+		}
+	}
+
+	if value, ok := os.LookupEnv("SNAPSHOT_MAX_AGE"); ok {
+		g_snapshotRetention.MaxAge, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalln("[SNAPSHOT] SNAPSHOT_MAX_AGE must be a duration like 168h -", err.Error())
+		}
+	}
+
+	// snapshots can still be listed with an interval of 0, only taking them is disabled
+	if interval <= 0 {
+		log.Println("[SNAPSHOT] SNAPSHOT_INTERVAL is 0, no snapshot will be taken")
+		return
+	}
+
+	go Snapshot_Run(interval)
+}
+
+// Snapshot_Run takes a snapshot every interval, forever
+func Snapshot_Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), SNAPSHOT_TIMEOUT)
+		err := Snapshot_Take(ctx, interval)
+		cancel()
+
+		if err != nil {
+			log.Printf("[SNAPSHOT] Failed to take a snapshot of the board - %s\n", err.Error())
+		}
+	}
+}
+
+// Snapshot_Take writes a snapshot of the board and prunes the old ones, unless another server
+// already did during this interval or the board did not change since the last snapshot
+func Snapshot_Take(ctx context.Context, interval time.Duration) error {
+	locked, err := g_redisClient.SetNX(ctx, SNAPSHOT_LOCK_KEY, "1", interval/2).Result()
+	if err != nil || !locked {
+		return err
+	}
+
+	captured, err := snapshot.Redis_Capture(ctx, g_redisClient)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := snapshot.List(ctx, g_snapshotBlobs)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 && snapshots[0].Version == captured.Version {
+		return nil
+	}
+
+	err = snapshot.Write(ctx, g_snapshotBlobs, &captured)
+	if err != nil {
+		return err
+	}
+	log.Printf("[SNAPSHOT] Wrote %s, %d bytes\n", captured.Name, captured.Size)
+
+	deleted, err := snapshot.Prune(ctx, g_snapshotBlobs, g_snapshotRetention, time.Now())
+	if len(deleted) > 0 {
+		log.Printf("[SNAPSHOT] Deleted %d old snapshots\n", len(deleted))
+	}
+
+	return err
+}
+
+// IsAdmin checks the admin token header against ADMIN_TOKEN like the Admin lambda, every request
+// is rejected when ADMIN_TOKEN is not set
+func IsAdmin(request *http.Request) bool {
+	expected := os.Getenv("ADMIN_TOKEN")
+	if expected == "" {
+		return false
+	}
+
+	token := request.Header.Get(ADMIN_TOKEN_HEADER)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// HandleSnapshots lists the snapshots of the board, newest first, to admins
+func HandleSnapshots(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !IsAdmin(request) {
+		response.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if g_snapshotBlobs == nil {
+		http.Error(response, "snapshots are disabled", http.StatusNotFound)
+		return
+	}
+
+	snapshots, err := snapshot.List(request.Context(), g_snapshotBlobs)
+	if err != nil {
+		log.Printf("[SNAPSHOT] Error listing snapshots - %s\n", err.Error())
+		response.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(response).Encode(snapshots)
+}
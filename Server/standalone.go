@@ -0,0 +1,89 @@
+//go:build standalone
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	admin "Admin/handler"
+	auth "Auth/handler"
+	getboard "GetBoard/handler"
+	getpalette "GetPalette/handler"
+	getpixel "GetPixel/handler"
+	getuser "GetUser/handler"
+	initializeredis "InitializeRedis/handler"
+	writepixel "WritePixel/handler"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func HandleRoute(mux *http.ServeMux, path string, handler http.HandlerFunc) {
+	// mirror the path patterns of the ALB listener rules in aws-dev.yaml
+	mux.HandleFunc(path, handler)
+	mux.HandleFunc(path+"/", handler)
+}
+
+// Standalone_Init connects every lambda handler to its backing stores and
+// mounts them next to the websocket server
+func Standalone_Init(mux *http.ServeMux) {
+	for name, init := range map[string]func() error{
+		"Admin":           admin.Init,
+		"Auth":            auth.Init,
+		"GetBoard":        getboard.Init,
+		"GetPalette":      getpalette.Init,
+		"GetPixel":        getpixel.Init,
+		"GetUser":         getuser.Init,
+		"InitializeRedis": initializeredis.Init,
+		"WritePixel":      writepixel.Init,
+	} {
+		err := init()
+		if err != nil {
+			log.Fatalf("[STANDALONE] Failed to initialize %s, exiting - %s\n", name, err.Error())
+		}
+	}
+
+	HandleRoute(mux, "/api/board", ServeLambda("GetBoard", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := getboard.HandleRequest(ctx, getboard.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/palette", ServeLambda("GetPalette", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := getpalette.HandleRequest(ctx, getpalette.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/getpixel", ServeLambda("GetPixel", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := getpixel.HandleRequest(ctx, getpixel.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/getuser", ServeLambda("GetUser", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := getuser.HandleRequest(ctx, getuser.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/writepixel", ServeLambda("WritePixel", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := writepixel.HandleRequest(ctx, writepixel.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/admin", ServeLambda("Admin", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := admin.HandleRequest(ctx, admin.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	HandleRoute(mux, "/api/auth", ServeLambda("Auth", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := auth.HandleRequest(ctx, auth.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	// not routed by the ALB in aws-dev.yaml, exposed here so the board can be rebuilt from cassandra locally
+	HandleRoute(mux, "/api/initializeredis", ServeLambda("InitializeRedis", func(ctx context.Context, request events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		response, err := initializeredis.HandleRequest(ctx, initializeredis.ALBRequest(request))
+		return events.ALBTargetGroupResponse(response), err
+	}))
+
+	log.Println("[STANDALONE] Serving lambda routes")
+}
@@ -0,0 +1,12 @@
+//go:build !standalone
+
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+func Standalone_Init(_ *http.ServeMux) {
+	log.Fatalln("[STANDALONE] Server was built without standalone support, rebuild it with -tags standalone")
+}
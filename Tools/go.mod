@@ -0,0 +1,16 @@
+module Tools
+
+go 1.19
+
+require (
+	github.com/go-redis/redis/v9 v9.0.0-rc.2
+	github.com/gocql/gocql v1.3.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/hailocab/go-hostpool v0.0.0-20160125115350-e80d13ce29ed // indirect
+	gopkg.in/inf.v0 v0.9.1 // indirect
+)
@@ -0,0 +1,23 @@
+// Package keyspace connects the command line tools to the Cassandra keyspace the lambdas write to.
+package keyspace
+
+import (
+	"Common/config"
+
+	"github.com/gocql/gocql"
+)
+
+type CassandraClient struct {
+	Session  *gocql.Session
+	Keyspace string
+}
+
+// Cassandra_Init connects to the keyspace with the same environment variables as the lambdas
+func Cassandra_Init() (*CassandraClient, error) {
+	session, err := config.Cassandra_Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CassandraClient{Session: session, Keyspace: config.GetKeyspace()}, nil
+}
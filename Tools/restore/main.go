@@ -0,0 +1,80 @@
+// Command restore loads a snapshot the go server took of the board back into redis, replacing
+// the board, its metadata and moving its version past every version clients saw.
+//
+//	restore -list
+//	restore -latest
+//	restore -name board-20221201T120000Z-v00000000000000123456.gz
+//
+// It reads snapshots from SNAPSHOT_BUCKET or SNAPSHOT_DIR like the server, and connects to redis
+// with the same environment variables as the lambdas.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"Common/config"
+	"Common/snapshot"
+)
+
+var g_list = flag.Bool("list", false, "list the snapshots, newest first, and exit")
+var g_latest = flag.Bool("latest", false, "restore the newest snapshot")
+var g_name = flag.String("name", "", "name of the snapshot to restore, see -list")
+
+func main() {
+	flag.Parse()
+
+	if !*g_list && (*g_latest == (*g_name != "")) {
+		log.Fatalln("pass -list, -latest or -name")
+	}
+
+	blobs, err := snapshot.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalln("[SNAPSHOT] Failed to open the snapshot store -", err.Error())
+	}
+	if blobs == nil {
+		log.Fatalln("[SNAPSHOT] Set SNAPSHOT_BUCKET or SNAPSHOT_DIR to where the server writes its snapshots")
+	}
+
+	ctx := context.Background()
+	snapshots, err := snapshot.List(ctx, blobs)
+	if err != nil {
+		log.Fatalln("[SNAPSHOT] Failed to list the snapshots -", err.Error())
+	}
+
+	if *g_list {
+		for _, info := range snapshots {
+			fmt.Printf("%s\tversion %d\t%s\t%d bytes\n", info.Name, info.Version, info.Timestamp.Format(time.RFC3339), info.Size)
+		}
+		return
+	}
+
+	name := *g_name
+	if *g_latest {
+		if len(snapshots) == 0 {
+			log.Fatalln("[SNAPSHOT] There is no snapshot to restore")
+		}
+		name = snapshots[0].Name
+	}
+
+	restored, err := snapshot.Read(ctx, blobs, name)
+	if err != nil {
+		log.Fatalln("[SNAPSHOT] Failed to read", name, "-", err.Error())
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		log.Fatalln("[REDIS]", err.Error())
+	}
+	defer client.Close()
+
+	err = snapshot.Redis_Restore(ctx, client, restored)
+	if err != nil {
+		log.Fatalln("[SNAPSHOT] Failed to restore", name, "-", err.Error())
+	}
+
+	log.Printf("[SNAPSHOT] Restored the %dx%d board of %s at version %d\n", restored.Metadata.Width, restored.Metadata.Height, restored.Timestamp.Format(time.RFC3339), restored.Version)
+}
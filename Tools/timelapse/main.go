@@ -0,0 +1,258 @@
+// Command timelapse replays the placements table onto an empty board and renders the board as
+// it was every -step, either as an animated gif or as a directory of png frames.
+//
+//	timelapse -from 2022-12-01T00:00:00Z -to 2022-12-02T00:00:00Z -step 1m -fps 30 -out timelapse.gif
+//	timelapse -from 2022-12-01T00:00:00Z -format png -out frames/
+//
+// It connects to cassandra with the same environment variables as the lambdas.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"Common/board"
+	"Common/boardimage"
+	"Common/config"
+	"Common/palette"
+	"Common/store"
+	"Tools/keyspace"
+)
+
+// keeps a typo in -step from writing millions of frames
+const MAX_FRAMES = 100000
+
+var g_from = flag.String("from", "", "start of the timelapse, RFC 3339 (required), the board is empty at this point")
+var g_to = flag.String("to", "", "end of the timelapse, RFC 3339, defaults to now")
+var g_step = flag.Duration("step", time.Minute, "board time between two frames")
+var g_fps = flag.Int("fps", 10, "frames per second of the gif, at most 100")
+var g_scale = flag.Int("scale", 1, "size of a board pixel in the output")
+var g_format = flag.String("format", "gif", "gif, or png for a directory of frames")
+var g_out = flag.String("out", "timelapse.gif", "gif file or frame directory to write")
+var g_width = flag.Int("width", board.DEFAULT_WIDTH, "board width, the largest it was during the timelapse if it was expanded")
+var g_height = flag.Int("height", board.DEFAULT_HEIGHT, "board height, the largest it was during the timelapse if it was expanded")
+
+// the replayed board holds any color index whatever the bits per pixel of the live board
+const REPLAY_BITS_PER_PIXEL = 8
+
+// FrameWriter receives the board after every step, dirty is the part of the board that changed
+// since the previous frame and is empty when nothing changed
+type FrameWriter interface {
+	WriteFrame(bitfield []uint8, dirty image.Rectangle) error
+	Close() error
+}
+
+// GifWriter collects frames into an animated gif, only the changed part of the board is stored
+// for every frame after the first one
+type GifWriter struct {
+	path    string
+	palette color.Palette
+	width   int // of the replayed board
+	height  int
+	scale   int
+	delay   int
+	gif     gif.GIF
+}
+
+func (writer *GifWriter) WriteFrame(bitfield []uint8, dirty image.Rectangle) error {
+	if len(writer.gif.Image) == 0 {
+		dirty = image.Rect(0, 0, writer.width, writer.height)
+	}
+
+	if dirty.Empty() {
+		// nothing changed, show the previous frame for longer
+		writer.gif.Delay[len(writer.gif.Delay)-1] += writer.delay
+		return nil
+	}
+
+	options := boardimage.Options{X: dirty.Min.X, Y: dirty.Min.Y, Width: dirty.Dx(), Height: dirty.Dy(), Scale: writer.scale}
+	frame := boardimage.Render(bitfield, writer.width, REPLAY_BITS_PER_PIXEL, writer.palette, options)
+	frame.Rect = frame.Rect.Add(dirty.Min.Mul(writer.scale))
+
+	writer.gif.Image = append(writer.gif.Image, frame)
+	writer.gif.Delay = append(writer.gif.Delay, writer.delay)
+	writer.gif.Disposal = append(writer.gif.Disposal, gif.DisposalNone)
+
+	return nil
+}
+
+func (writer *GifWriter) Close() error {
+	if len(writer.gif.Image) == 0 {
+		return errors.New("no frames were rendered")
+	}
+
+	writer.gif.Config = image.Config{ColorModel: writer.palette, Width: writer.width * writer.scale, Height: writer.height * writer.scale}
+
+	file, err := os.Create(writer.path)
+	if err != nil {
+		return err
+	}
+
+	err = gif.EncodeAll(file, &writer.gif)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// PngWriter writes every frame to its own numbered png file
+type PngWriter struct {
+	directory string
+	palette   color.Palette
+	width     int // of the replayed board
+	height    int
+	scale     int
+	frames    int
+}
+
+func (writer *PngWriter) WriteFrame(bitfield []uint8, dirty image.Rectangle) error {
+	options := boardimage.Options{X: 0, Y: 0, Width: writer.width, Height: writer.height, Scale: writer.scale}
+	data, err := boardimage.EncodePNG(bitfield, writer.width, REPLAY_BITS_PER_PIXEL, writer.palette, options)
+	if err != nil {
+		return err
+	}
+
+	writer.frames++
+	return os.WriteFile(filepath.Join(writer.directory, fmt.Sprintf("frame_%06d.png", writer.frames)), data, 0644)
+}
+
+func (writer *PngWriter) Close() error {
+	return nil
+}
+
+func NewFrameWriter(palette color.Palette) (FrameWriter, error) {
+	switch *g_format {
+	case "gif":
+		if *g_fps < 1 || *g_fps > 100 {
+			return nil, errors.New("-fps must be between 1 and 100")
+		}
+
+		// gif delays are in hundredths of a second
+		return &GifWriter{path: *g_out, palette: palette, width: *g_width, height: *g_height, scale: *g_scale, delay: 100 / *g_fps}, nil
+	case "png":
+		err := os.MkdirAll(*g_out, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PngWriter{directory: *g_out, palette: palette, width: *g_width, height: *g_height, scale: *g_scale}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", *g_format)
+}
+
+// Replay applies every placement of pixels in [from, to) to an empty width x height board and hands
+// the board to writer after every step
+func Replay(ctx context.Context, pixels store.PixelRepository, width int, height int, from time.Time, to time.Time, step time.Duration, writer FrameWriter) (int, error) {
+	bitfield := make([]uint8, board.Metadata{Width: width, Height: height, BitsPerPixel: REPLAY_BITS_PER_PIXEL}.BitfieldSize())
+	dirty := image.Rectangle{}
+	nextFrame := from.Add(step)
+	placements := 0
+
+	flush := func(until time.Time) error {
+		for !nextFrame.After(until) {
+			err := writer.WriteFrame(bitfield, dirty)
+			if err != nil {
+				return err
+			}
+
+			dirty = image.Rectangle{}
+			nextFrame = nextFrame.Add(step)
+		}
+
+		return nil
+	}
+
+	err := pixels.ScanPlacements(ctx, from, to, func(pixel store.Pixel, seq uint64, ts time.Time) error {
+		err := flush(ts)
+		if err != nil {
+			return err
+		}
+
+		x, y := int(pixel.X), int(pixel.Y)
+		if x >= width || y >= height {
+			log.Printf("[TIMELAPSE] Skipping placement %d outside the board at %d,%d\n", seq, x, y)
+			return nil
+		}
+
+		boardimage.SetPixel(bitfield, y*width+x, REPLAY_BITS_PER_PIXEL, pixel.Col)
+		dirty = dirty.Union(image.Rect(x, y, x+1, y+1))
+		placements++
+
+		return nil
+	})
+	if err != nil {
+		return placements, err
+	}
+
+	return placements, flush(to)
+}
+
+func main() {
+	flag.Parse()
+
+	from, err := time.Parse(time.RFC3339, *g_from)
+	if err != nil {
+		log.Fatalln("-from must be an RFC 3339 time -", err.Error())
+	}
+
+	to := time.Now()
+	if *g_to != "" {
+		to, err = time.Parse(time.RFC3339, *g_to)
+		if err != nil {
+			log.Fatalln("-to must be an RFC 3339 time -", err.Error())
+		}
+	}
+
+	if !to.After(from) || *g_step <= 0 || int64(to.Sub(from) / *g_step) > MAX_FRAMES {
+		log.Fatalf("-from, -to and -step must produce between 1 and %d frames\n", MAX_FRAMES)
+	}
+
+	if *g_scale < 1 || *g_scale > boardimage.MAX_SCALE {
+		log.Fatalf("-scale must be between 1 and %d\n", boardimage.MAX_SCALE)
+	}
+
+	if (board.Metadata{Width: *g_width, Height: *g_height, BitsPerPixel: REPLAY_BITS_PER_PIXEL}).Validate() != nil {
+		log.Fatalf("-width and -height must be between 1 and %d\n", board.MAX_DIMENSION)
+	}
+
+	colors, err := palette.Image()
+	if err != nil {
+		log.Fatalln("[PALETTE] Failed to parse the palette -", err.Error())
+	}
+
+	writer, err := NewFrameWriter(colors)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	client, err := keyspace.Cassandra_Init()
+	if err != nil {
+		log.Fatalln("[KEYSPACE] Failed to connect -", err.Error())
+	}
+	defer client.Session.Close()
+
+	pixels := store.NewCassandraPixelRepository(client.Session, client.Keyspace, config.GetCassandraTables())
+	placements, err := Replay(context.Background(), pixels, *g_width, *g_height, from, to, *g_step, writer)
+	if err != nil {
+		log.Fatalln("[TIMELAPSE] Failed to replay placements -", err.Error())
+	}
+
+	err = writer.Close()
+	if err != nil {
+		log.Fatalln("[TIMELAPSE] Failed to write", *g_out, "-", err.Error())
+	}
+
+	log.Printf("[TIMELAPSE] Replayed %d placements into %s\n", placements, *g_out)
+}
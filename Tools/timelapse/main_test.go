@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Common/boardimage"
+	"Common/palette"
+	"Common/store"
+)
+
+// recordingWriter keeps a copy of every frame it is given
+type recordingWriter struct {
+	bitfields [][]uint8
+	dirty     []image.Rectangle
+}
+
+func (writer *recordingWriter) WriteFrame(bitfield []uint8, dirty image.Rectangle) error {
+	writer.bitfields = append(writer.bitfields, append([]uint8(nil), bitfield...))
+	writer.dirty = append(writer.dirty, dirty)
+	return nil
+}
+
+func (writer *recordingWriter) Close() error {
+	return nil
+}
+
+const testWidth = 4
+const testHeight = 3
+
+var testFrom = time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)
+
+// two placements in the first minute, one in the second and none in the third, one before and one
+// after the timelapse and one outside of the board
+func newTestPixels(t *testing.T) *store.MemoryPixelRepository {
+	pixels := store.NewMemoryPixelRepository()
+	for i, placement := range []struct {
+		pixel store.Pixel
+		after time.Duration
+	}{
+		{store.Pixel{X: 3, Y: 0, Col: 9}, -time.Second},
+		{store.Pixel{X: 2, Y: 1, Col: 3}, 20 * time.Second},
+		{store.Pixel{X: 1, Y: 1, Col: 2}, 10 * time.Second},
+		{store.Pixel{X: 0, Y: 2, Col: 4}, 70 * time.Second},
+		{store.Pixel{X: 9, Y: 0, Col: 5}, 80 * time.Second},
+		{store.Pixel{X: 3, Y: 2, Col: 6}, 3 * time.Minute},
+	} {
+		err := pixels.Upsert(context.Background(), placement.pixel, uint64(i+1), testFrom.Add(placement.after))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return pixels
+}
+
+func replay(t *testing.T, writer FrameWriter) {
+	placements, err := Replay(context.Background(), newTestPixels(t), testWidth, testHeight, testFrom, testFrom.Add(3*time.Minute), time.Minute, writer)
+	if err != nil || placements != 3 {
+		t.Fatalf("expected 3 placements to be replayed, got %d (%v)", placements, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	writer := &recordingWriter{}
+	replay(t, writer)
+
+	expectedDirty := []image.Rectangle{image.Rect(1, 1, 3, 2), image.Rect(0, 2, 1, 3), {}}
+	if len(writer.dirty) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(writer.dirty))
+	}
+	for i, dirty := range writer.dirty {
+		if dirty != expectedDirty[i] {
+			t.Fatalf("expected frame %d to have changed in %v, got %v", i, expectedDirty[i], dirty)
+		}
+	}
+
+	// the placement of the second minute only shows up in the frames after the first one
+	colors := func(bitfield []uint8) [4]uint8 {
+		at := func(x int, y int) uint8 { return boardimage.GetPixel(bitfield, y*testWidth+x, REPLAY_BITS_PER_PIXEL) }
+		return [4]uint8{at(1, 1), at(2, 1), at(0, 2), at(3, 0)}
+	}
+	for i, expected := range [][4]uint8{{2, 3, 0, 0}, {2, 3, 4, 0}, {2, 3, 4, 0}} {
+		if colors(writer.bitfields[i]) != expected {
+			t.Fatalf("expected frame %d to have colors %v, got %v", i, expected, colors(writer.bitfields[i]))
+		}
+	}
+}
+
+func TestGifWriterStoresOnlyTheChangedPart(t *testing.T) {
+	colors, err := palette.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "timelapse.gif")
+	writer := &GifWriter{path: path, palette: colors, width: testWidth, height: testHeight, scale: 2, delay: 10}
+	replay(t, writer)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the frame where nothing changed shows the previous one for longer
+	if animation.Config.Width != 8 || animation.Config.Height != 6 || len(animation.Image) != 2 {
+		t.Fatalf("expected 2 frames of an 8x6 gif, got %d of %dx%d", len(animation.Image), animation.Config.Width, animation.Config.Height)
+	}
+	if animation.Delay[0] != 10 || animation.Delay[1] != 20 {
+		t.Fatalf("expected delays 10 and 20, got %v", animation.Delay)
+	}
+	if animation.Image[0].Bounds() != image.Rect(0, 0, 8, 6) || animation.Image[1].Bounds() != image.Rect(0, 4, 2, 6) {
+		t.Fatalf("expected the whole board then the changed pixel, got %v and %v", animation.Image[0].Bounds(), animation.Image[1].Bounds())
+	}
+	if animation.Image[0].At(2, 2) != colors[2] || animation.Image[1].At(1, 5) != colors[4] {
+		t.Fatalf("expected the placed colors, got %v and %v", animation.Image[0].At(2, 2), animation.Image[1].At(1, 5))
+	}
+}
+
+func TestPngWriterWritesEveryFrame(t *testing.T) {
+	colors, err := palette.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := t.TempDir()
+	replay(t, &PngWriter{directory: directory, palette: colors, width: testWidth, height: testHeight, scale: 1})
+
+	for i, expected := range []int{0, 4, 4} {
+		file, err := os.Open(filepath.Join(directory, fmt.Sprintf("frame_%06d.png", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Bounds() != image.Rect(0, 0, testWidth, testHeight) || frame.At(0, 2) != colors[expected] {
+			t.Fatalf("expected frame %d to be the whole board with color %d at 0,2, got %v and %v", i+1, expected, frame.Bounds(), frame.At(0, 2))
+		}
+	}
+}
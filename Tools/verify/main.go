@@ -0,0 +1,78 @@
+// Command verify compares every row of the rplace table with the pixel of the live board and
+// prints a JSON report of the pixels they disagree on, totaled per chunk of the board.
+//
+//	verify -chunk 100 -samples 20
+//	verify -repair cassandra-to-redis
+//
+// With -repair the store on the right is made to agree with the one on the left. Pixels repaired
+// in redis are published to connected clients, pixels repaired in Cassandra are recorded as
+// written by [repair]. It connects with the same environment variables as the lambdas.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"Common/config"
+	"Common/consistency"
+	"Common/store"
+	"Tools/keyspace"
+)
+
+var g_repair = flag.String("repair", "", "repair the mismatches, "+consistency.DIRECTION_TO_REDIS+" or "+consistency.DIRECTION_TO_CASSANDRA)
+var g_chunk = flag.Int("chunk", consistency.DEFAULT_CHUNK_SIZE, "side of the square chunks mismatches are totaled in")
+var g_samples = flag.Int("samples", consistency.DEFAULT_SAMPLES, "mismatches listed in the report")
+
+func main() {
+	flag.Parse()
+
+	if *g_repair != "" && *g_repair != consistency.DIRECTION_TO_REDIS && *g_repair != consistency.DIRECTION_TO_CASSANDRA {
+		log.Fatalln("-repair", consistency.ErrInvalidDirection.Error())
+	}
+	if *g_chunk < 1 || *g_samples < 1 {
+		log.Fatalln("-chunk and -samples must be positive")
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		log.Fatalln("[REDIS]", err.Error())
+	}
+	defer client.Close()
+
+	cassandra, err := keyspace.Cassandra_Init()
+	if err != nil {
+		log.Fatalln("[KEYSPACE] Failed to connect -", err.Error())
+	}
+	defer cassandra.Session.Close()
+
+	ctx := context.Background()
+	boardStore := store.NewRedisBoardStore(client)
+	pixels := store.NewCassandraPixelRepository(cassandra.Session, cassandra.Keyspace, config.GetCassandraTables())
+
+	report, mismatches, err := consistency.Check(ctx, boardStore, pixels, consistency.Options{ChunkSize: *g_chunk, Samples: *g_samples})
+	if err != nil {
+		log.Fatalln("[VERIFY] Failed to compare the stores -", err.Error())
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		log.Fatalln("[VERIFY] Failed to write the report -", err.Error())
+	}
+
+	log.Printf("[VERIFY] %d mismatches in %d rows, %d of them missing from Cassandra, %d rows skipped\n", report.Mismatches, report.RowsRead, report.Missing, report.RowsSkipped)
+	if *g_repair == "" || len(mismatches) == 0 {
+		return
+	}
+
+	repaired, err := consistency.Repair(ctx, boardStore, pixels, report.Metadata, mismatches, *g_repair)
+	if err != nil {
+		log.Fatalf("[VERIFY] Failed to repair after %d pixels - %s\n", repaired, err.Error())
+	}
+
+	log.Printf("[VERIFY] Repaired %d pixels %s\n", repaired, *g_repair)
+}
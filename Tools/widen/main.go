@@ -0,0 +1,54 @@
+// Command widen converts the live board to more bits per pixel so it can hold more colors, every
+// pixel keeps its color index.
+//
+//	REDIS_ENDPOINT=... REDIS_PORT=... go run ./widen -bits 8
+//
+// Pixels written while the board is converted are not lost, the conversion is retried instead.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"Common/board"
+	"Common/config"
+)
+
+var g_bits = flag.Int("bits", 8, "bits per pixel to convert the board to, 5 for 32 colors or 8 for 256")
+var g_dryRun = flag.Bool("dry-run", false, "only report the current encoding and the size of the converted bitfield")
+
+func main() {
+	flag.Parse()
+
+	if !board.IsBitsPerPixel(*g_bits) {
+		log.Fatalf("-bits must be one of %v\n", board.BITS_PER_PIXEL)
+	}
+
+	client, err := config.Redis_Init()
+	if err != nil {
+		log.Fatalln("[REDIS]", err.Error())
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	if *g_dryRun {
+		from, err := board.Redis_GetMetadata(ctx, client)
+		if err != nil {
+			log.Fatalln("[REDIS] Failed to read the board metadata -", err.Error())
+		}
+
+		to := from
+		to.BitsPerPixel = *g_bits
+		log.Printf("[WIDEN] %dx%d board with %d bits per pixel (%d bytes), would take %d bytes with %d bits per pixel\n",
+			from.Width, from.Height, from.BitsPerPixel, from.BitfieldSize(), to.BitfieldSize(), to.BitsPerPixel)
+		return
+	}
+
+	from, to, err := board.Redis_WidenPixels(ctx, client, *g_bits)
+	if err != nil {
+		log.Fatalln("[WIDEN] Failed to convert the board -", err.Error())
+	}
+
+	log.Printf("[WIDEN] Converted the %dx%d board from %d to %d bits per pixel, %d colors\n", to.Width, to.Height, from.BitsPerPixel, to.BitsPerPixel, to.Colors())
+}